@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/paulmach/orb/geojson"
+	"github.com/spf13/viper"
+)
+
+var errUnknownAppointmentShape = errors.New("unknown appointments shape")
+
+// parseAppointments normalizes the appointments property, whichever of the shapes the
+// upstreams use it's in, to the fields of each appointment:
+//
+//	[{"time": ..., "type": ...}, ...]  as is
+//	["2021-05-01T09:00:00", ...]       just the times, taken as {"time": ...}
+//	12                                 just a count, returned as count
+//
+// Entries of any other shape are skipped, and reported in the error along with the
+// appointments that could be read.
+func parseAppointments(v interface{}) ([]map[string]interface{}, int, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, 0, nil
+
+	case []interface{}:
+		var (
+			ret     []map[string]interface{}
+			unknown error
+		)
+
+		for _, appt := range v {
+			switch appt := appt.(type) {
+			case map[string]interface{}:
+				ret = append(ret, appt)
+			case string:
+				ret = append(ret, map[string]interface{}{"time": appt})
+			default:
+				if unknown == nil {
+					unknown = fmt.Errorf("%w: array of %T", errUnknownAppointmentShape, appt)
+				}
+			}
+		}
+		return ret, 0, unknown
+
+	case float64:
+		if v >= 0 {
+			return nil, int(v), nil
+		}
+	}
+	return nil, 0, fmt.Errorf("%w: %T", errUnknownAppointmentShape, v)
+}
+
+// featureAppointments returns the details of each of f's appointments, if it has them.
+func featureAppointments(f *geojson.Feature) []map[string]interface{} {
+	ret, _, _ := parseAppointments(f.Properties[viper.GetString("appointments-field")])
+
+	return ret
+}
+
+// checkAppointmentsShape logs, once for each shape, appointments we couldn't make sense of
+// and so ignored. It may be called concurrently.
+func (c *Checker) checkAppointmentsShape(f *geojson.Feature) {
+	_, _, err := parseAppointments(f.Properties[viper.GetString("appointments-field")])
+	if err == nil {
+		return
+	}
+
+	c.shapeMu.Lock()
+	defer c.shapeMu.Unlock()
+
+	if c.warnedShapes[err.Error()] {
+		return
+	}
+	if c.warnedShapes == nil {
+		c.warnedShapes = map[string]bool{}
+	}
+	c.warnedShapes[err.Error()] = true
+
+	c.log.Warn().Err(err).Int("id", featureID(f)).Msg("skipping appointments in a shape it doesn't understand, logged once per shape")
+}
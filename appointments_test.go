@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+func TestParseAppointments(t *testing.T) {
+	tests := []struct {
+		name      string
+		v         interface{}
+		want      []map[string]interface{}
+		wantCount int
+		wantErr   bool
+	}{
+		{name: "missing"},
+		{
+			name: "objects",
+			v: []interface{}{
+				map[string]interface{}{"time": "2021-05-01T09:00:00", "type": "Pfizer"},
+				map[string]interface{}{"time": "2021-05-01T09:15:00"},
+			},
+			want: []map[string]interface{}{
+				{"time": "2021-05-01T09:00:00", "type": "Pfizer"},
+				{"time": "2021-05-01T09:15:00"},
+			},
+		},
+		{
+			name: "times",
+			v:    []interface{}{"2021-05-01T09:00:00", "2021-05-01T09:15:00"},
+			want: []map[string]interface{}{
+				{"time": "2021-05-01T09:00:00"},
+				{"time": "2021-05-01T09:15:00"},
+			},
+		},
+		{name: "count", v: 12.0, wantCount: 12},
+		{
+			name:    "mixed",
+			v:       []interface{}{"2021-05-01T09:00:00", 3.0},
+			want:    []map[string]interface{}{{"time": "2021-05-01T09:00:00"}},
+			wantErr: true,
+		},
+		{name: "negative count", v: -1.0, wantErr: true},
+		{name: "object", v: map[string]interface{}{"time": "2021-05-01T09:00:00"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, count, err := parseAppointments(tt.v)
+
+			if !reflect.DeepEqual(got, tt.want) || count != tt.wantCount {
+				t.Errorf("got %v, %d, want %v, %d", got, count, tt.want, tt.wantCount)
+			}
+			if tt.wantErr != (err != nil) {
+				t.Errorf("got error %v, want error %t", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, errUnknownAppointmentShape) {
+				t.Errorf("got %v, want %v", err, errUnknownAppointmentShape)
+			}
+		})
+	}
+}
+
+func TestAppointmentCount(t *testing.T) {
+	setConfig(t, nil)
+
+	tests := []struct {
+		name string
+		v    interface{}
+		want int
+	}{
+		{"objects", []interface{}{map[string]interface{}{"time": "9:00"}, map[string]interface{}{"time": "9:15"}}, 2},
+		{"times", []interface{}{"9:00", "9:15", "9:30"}, 3},
+		{"count", 12.0, 12},
+		{"zero count", 0.0, 5},
+		{"missing", nil, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := geojson.NewFeature(orb.Point{-74, 40.7})
+			if tt.v != nil {
+				f.Properties["appointments"] = tt.v
+			}
+			if got := appointmentCount(f, 5); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	vaccinePfizer  = "pfizer"
+	vaccineModerna = "moderna"
+	vaccineJJ      = "jj"
+	vaccineUnknown = "unknown"
+
+	dose1       = "1"
+	dose2       = "2"
+	doseBooster = "booster"
+)
+
+var errInvalidTypeMap = errors.New("invalid --type-map, should be text=value, with a value of pfizer, moderna, jj, 1, 2 or booster, or a vaccine/dose pair")
+
+// defaultTypeMap recognizes the labels the upstreams are known to use. --type-map entries
+// are checked before these.
+var defaultTypeMap = []string{
+	"pfizer=pfizer",
+	"biontech=pfizer",
+	"comirnaty=pfizer",
+	"moderna=moderna",
+	"spikevax=moderna",
+	"janssen=jj",
+	"johnson=jj",
+	"j&j=jj",
+	"jj=jj",
+	"1st=1",
+	"first=1",
+	"dose 1=1",
+	"dose_1=1",
+	"_1=1",
+	"2nd=2",
+	"second=2",
+	"dose 2=2",
+	"dose_2=2",
+	"_2=2",
+	"booster=booster",
+	"3rd=booster",
+	"third=booster",
+}
+
+// apptType is an appointment type normalized to a vaccine and, if it says, a dose.
+type apptType struct {
+	Vaccine string
+	Dose    string
+}
+
+type typeMapping struct {
+	match   string
+	vaccine string
+	dose    string
+}
+
+// typeMap parses --type-map and the defaults into mappings, in the order to check them:
+// each list longest match first, so "dose 1" wins over "1".
+func typeMap() ([]typeMapping, error) {
+	custom, err := parseTypeMap(viper.GetStringSlice("type-map"))
+	if err != nil {
+		return nil, err
+	}
+	return append(custom, defaultMappings...), nil
+}
+
+var defaultMappings, _ = parseTypeMap(defaultTypeMap)
+
+func parseTypeMap(entries []string) ([]typeMapping, error) {
+	var ret []typeMapping
+
+	for _, e := range entries {
+		i := strings.LastIndex(e, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("%w: %s", errInvalidTypeMap, e)
+		}
+		m := typeMapping{match: strings.ToLower(strings.TrimSpace(e[:i]))}
+
+		for _, v := range strings.Split(strings.ToLower(strings.TrimSpace(e[i+1:])), "/") {
+			switch v {
+			case vaccinePfizer, vaccineModerna, vaccineJJ:
+				m.vaccine = v
+			case dose1, dose2, doseBooster:
+				m.dose = v
+			default:
+				return nil, fmt.Errorf("%w: %s", errInvalidTypeMap, e)
+			}
+		}
+		ret = append(ret, m)
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool { return len(ret[i].match) > len(ret[j].match) })
+
+	return ret, nil
+}
+
+// normalizeType maps a raw appointment type like "Pfizer - 2nd Dose" or "pfizer_1" to a
+// vaccine and dose, using the first of mappings matching each.
+func normalizeType(raw string, mappings []typeMapping) apptType {
+	ret := apptType{Vaccine: vaccineUnknown}
+
+	raw = strings.ToLower(raw)
+
+	var vaccineFound, doseFound bool
+
+	for _, m := range mappings {
+		if !strings.Contains(raw, m.match) {
+			continue
+		}
+		if m.vaccine != "" && !vaccineFound {
+			ret.Vaccine, vaccineFound = m.vaccine, true
+		}
+		if m.dose != "" && !doseFound {
+			ret.Dose, doseFound = m.dose, true
+		}
+	}
+	return ret
+}
+
+// String is how the type is shown, e.g. "pfizer dose 2" or "moderna booster", or nothing
+// if the vaccine isn't known.
+func (t apptType) String() string {
+	switch {
+	case t.Vaccine == vaccineUnknown:
+		return ""
+	case t.Dose == doseBooster:
+		return t.Vaccine + " booster"
+	case t.Dose != "":
+		return t.Vaccine + " dose " + t.Dose
+	}
+	return t.Vaccine
+}
+
+type typeMapKey struct{}
+
+// withTypeMap passes the checker's type map on to the notifiers.
+func withTypeMap(ctx context.Context, mappings []typeMapping) context.Context {
+	return context.WithValue(ctx, typeMapKey{}, mappings)
+}
+
+// typeMapFrom is the type map in ctx, or just the defaults if there isn't one.
+func typeMapFrom(ctx context.Context) []typeMapping {
+	if mappings, ok := ctx.Value(typeMapKey{}).([]typeMapping); ok {
+		return mappings
+	}
+	return defaultMappings
+}
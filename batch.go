@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/paulmach/orb/geojson"
+	"github.com/spf13/viper"
+)
+
+// how many times a site can fail to go out in a batch before it's dropped rather than queued
+// again, so a notifier that's down for good doesn't keep it retrying forever
+const maxBatchAttempts = 3
+
+// queue holds found until the batch waiting to be sent goes out, starting one that waits
+// for wait if there isn't one already.
+func (c *Checker) queue(ctx context.Context, found []*geojson.Feature, wait time.Duration) {
+	c.batchMu.Lock()
+	defer c.batchMu.Unlock()
+
+	c.batch = append(c.batch, found...)
+	c.batchResult = resultFrom(ctx)
+
+	if c.batchTimer == nil {
+		c.log.Info().Dur("window", wait).Msgf("holding notifications for %v", wait.Round(time.Second))
+
+		c.batchTimer = time.AfterFunc(wait, func() { c.flush(context.Background(), true) })
+	}
+}
+
+// throttleWait is how much longer --notify-min-interval says to wait before notifying.
+func (c *Checker) throttleWait(now time.Time) time.Duration {
+	interval := viper.GetDuration("notify-min-interval")
+	if interval <= 0 {
+		return 0
+	}
+
+	c.batchMu.Lock()
+	defer c.batchMu.Unlock()
+
+	if c.lastSent.IsZero() {
+		return 0
+	}
+	return c.lastSent.Add(interval).Sub(now)
+}
+
+// Flush sends whatever's being held for the --notify-batch-window or --notify-min-interval,
+// so nothing is lost when shutting down.
+func (c *Checker) Flush(ctx context.Context) {
+	c.flush(ctx, false)
+}
+
+// flush sends the batch, recording the sites as notified once every notifier has had them.
+// Any that haven't are queued again if requeue is set, up to maxBatchAttempts, or otherwise
+// left unrecorded, so they're notified about after a restart. It waits for any check in progress, which works
+// with the same record of what's been sent.
+func (c *Checker) flush(ctx context.Context, requeue bool) {
+	c.checkMu.Lock()
+	defer c.checkMu.Unlock()
+
+	c.batchMu.Lock()
+	found, result := c.batch, c.batchResult
+	c.batch, c.batchResult = nil, nil
+
+	if c.batchTimer != nil {
+		c.batchTimer.Stop()
+		c.batchTimer = nil
+	}
+	c.batchMu.Unlock()
+
+	if len(found) == 0 {
+		return
+	}
+	ctx = withResult(ctx, result)
+
+	notified, err := c.send(ctx, found)
+	c.recordNotified(notified, time.Now())
+	c.batchSent(notified)
+
+	if serr := c.saveState(notified); serr != nil {
+		c.log.Error().Err(serr).Msg("error saving state")
+	}
+	if err == nil {
+		return
+	}
+
+	pending := without(found, notified)
+	c.log.Error().Err(err).Int("sites", len(pending)).Msg("error sending batched notification")
+
+	if !requeue {
+		return
+	}
+	pending, dropped := c.batchFailed(pending)
+
+	if len(dropped) > 0 {
+		c.log.Error().Int("sites", len(dropped)).Int("attempts", maxBatchAttempts).Msg("giving up on batched notification")
+	}
+	if len(pending) > 0 {
+		wait := viper.GetDuration("notify-batch-window")
+		if i := viper.GetDuration("notify-min-interval"); i > wait {
+			wait = i
+		}
+		if wait <= 0 {
+			// both turned off since, by a reload
+			wait = viper.GetDuration("check-interval")
+		}
+		c.queue(ctx, pending, wait)
+	}
+}
+
+// batchSent forgets how many times the sites in sent failed to go out.
+func (c *Checker) batchSent(sent []*geojson.Feature) {
+	c.batchMu.Lock()
+	defer c.batchMu.Unlock()
+
+	for _, f := range sent {
+		delete(c.batchFailures, featureKey(f))
+	}
+}
+
+// batchFailed counts another failure for each of failed, returning those to queue again
+// and those that have failed maxBatchAttempts times already.
+func (c *Checker) batchFailed(failed []*geojson.Feature) (retry, dropped []*geojson.Feature) {
+	c.batchMu.Lock()
+	defer c.batchMu.Unlock()
+
+	for _, f := range failed {
+		key := featureKey(f)
+
+		if c.batchFailures[key]++; c.batchFailures[key] < maxBatchAttempts {
+			retry = append(retry, f)
+		} else {
+			delete(c.batchFailures, key)
+			dropped = append(dropped, f)
+		}
+	}
+	return retry, dropped
+}
+
+// batchKeys is the featureKey of each site waiting to go out in a batch.
+func (c *Checker) batchKeys() map[string]struct{} {
+	c.batchMu.Lock()
+	defer c.batchMu.Unlock()
+
+	return featureKeys(c.batch)
+}
@@ -1,103 +1,1214 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
+	"math/rand"
 	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"text/template"
 	"time"
 
+	"github.com/antonmedv/expr/vm"
+	"github.com/hashicorp/go-multierror"
 	"github.com/paulmach/orb"
-	"github.com/paulmach/orb/geo"
 	"github.com/paulmach/orb/geojson"
+	"github.com/rs/zerolog"
 	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	userAgent = "vaccine-checker (+https://github.com/carldunham/vaccine-checker)"
+
+	contentTypeForm = "application/x-www-form-urlencoded"
+	contentTypeJSON = "application/json"
 )
 
 var (
 	errInvalidStatusReturned = errors.New("unexpected status returned")
+	errInvalidContentType    = errors.New("unsupported content type")
+	errInvalidParam          = errors.New("invalid param, should be key=value")
+	errInvalidHeader         = errors.New("invalid header, should be key:value")
 )
 
-func check(ctx context.Context, location orb.Point, distance float64) error {
-	req, err := http.NewRequest(viper.GetString("search-method"), searchURL(), body())
+// CheckResult summarizes what a check found.
+type CheckResult struct {
+	Available   int                `json:"available"`
+	Nearby      int                `json:"nearby"`
+	New         int                `json:"new"`
+	NewFeatures []*geojson.Feature `json:"-"`
+	Notified    int                `json:"-"` // how many of them were successfully notified about
+	Queued      int                `json:"-"` // how many are held for a batched notification instead
+}
+
+// Checker checks for available appointments around one or more locations, remembering
+// what it found last time so it only notifies about new sites.
+type Checker struct {
+	Locations orb.MultiPoint
+	Distance  float64
+	Unit      string
+
+	// sites closer than this are skipped, in meters like Distance
+	MinDistance float64
+
+	log          zerolog.Logger
+	source       SearchSource
+	notifyClient *http.Client
+	notifiers    []namedNotifier
+	lastFound    []*geojson.Feature
+	lastKeys     map[string]struct{}        // featureKey of each of lastFound, or at first of the state file's sites
+	handled      bool                       // whether a check has got as far as handle yet
+	lastNotified map[string]time.Time       // by featureKey
+	delivered    map[string]map[string]bool // notifiers that have had each site still pending, by featureKey
+	state        *stateStore
+	results      *resultStore
+	window       appointmentWindow
+	trend        *distanceTrend
+	filter       *vm.Program   // compiled --filter, nil if there isn't one
+	typeMap      []typeMapping // parsed --type-map, with the defaults
+	stats        *runStats
+
+	// held for the whole of a check, so scheduled and triggered ones take turns
+	checkMu sync.Mutex
+
+	mu          sync.Mutex
+	lastSuccess time.Time
+
+	batchMu       sync.Mutex
+	batch         []*geojson.Feature
+	batchResult   *CheckResult
+	batchTimer    *time.Timer
+	batchFailures map[string]int // how many times each site in the batch failed to go out, by featureKey
+	lastSent      time.Time      // when a notification last went out, for --notify-min-interval
+
+	shapeMu      sync.Mutex
+	warnedShapes map[string]bool // appointment shapes already logged by checkAppointmentsShape
+}
+
+func NewChecker(source SearchSource, locations orb.MultiPoint, distance float64, unit string, log zerolog.Logger) (*Checker, error) {
+	c := &Checker{
+		log:           log,
+		lastNotified:  map[string]time.Time{},
+		delivered:     map[string]map[string]bool{},
+		batchFailures: map[string]int{},
+		stats:         newRunStats(),
+	}
+
+	err := c.configure(source, locations, distance, unit)
 	if err != nil {
-		return fmt.Errorf("error creating request: %w", err)
+		return nil, err
+	}
+
+	if path := viper.GetString("sqlite-db"); path != "" {
+		if c.results, err = openResultStore(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if path := viper.GetString("state-file"); path != "" {
+		ttl := viper.GetDuration("state-ttl")
+		if viper.GetBool("notify-once-per-site") {
+			ttl = 0
+		}
+
+		state, err := loadState(path, ttl)
+		if err != nil {
+			return nil, err
+		}
+		c.state = state
+
+		if viper.GetBool("reset-notified") && len(state.Notified) > 0 {
+			log.Info().Int("sites", len(state.Notified)).Msgf("forgetting the %d sites already notified about", len(state.Notified))
+
+			state.Notified = map[string]time.Time{}
+			if err := state.save(); err != nil {
+				return nil, fmt.Errorf("error saving state: %w", err)
+			}
+		}
+
+		// seed what was last found with what we've already notified about, so the first
+		// check stays quiet
+		c.setLastFound(nil)
+		for key := range state.Notified {
+			c.lastKeys[key] = struct{}{}
+		}
 	}
-	fmt.Printf("\n*** Checking at %s ***\n\n", time.Now().Format(time.RFC1123))
+	return c, nil
+}
+
+// configure sets up everything that can change when the config is reloaded.
+func (c *Checker) configure(source SearchSource, locations orb.MultiPoint, distance float64, unit string) error {
+	var (
+		transport = withDebug(newTransport("notification"), c.log.With().Str("client", "notification").Logger())
+		client    = &http.Client{Timeout: viper.GetDuration("notification-timeout"), Transport: transport}
+		notifiers []namedNotifier
+	)
 
-	resp, err := http.DefaultClient.Do(req)
+	if viper.GetBool("silent") {
+		notifiers = []namedNotifier{{"silent", nopNotifier{}}}
+	} else {
+		for _, name := range notifierNames() {
+			n, err := newNotifier(name, client, locations, unit)
+			if err != nil {
+				return err
+			}
+			notifiers = append(notifiers, namedNotifier{name, n})
+		}
+	}
+
+	window, err := appointmentWindowFromConfig()
 	if err != nil {
-		return fmt.Errorf("error fetching appointments: %v", err)
+		return err
 	}
-	defer resp.Body.Close()
 
-	var fc geojson.FeatureCollection
+	filter, err := compileFilter()
+	if err != nil {
+		return err
+	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&fc); err != nil {
+	mappings, err := typeMap()
+	if err != nil {
 		return err
 	}
-	return handle(ctx, location, distance, &fc)
+
+	c.Locations = locations
+	c.Distance = distance
+	c.Unit = unit
+	c.MinDistance = viper.GetFloat64("min-distance") * distanceUnits[unit]
+	c.source = source
+	c.window = window
+	c.filter = filter
+
+	// keep the history unless there's to be a different amount of it
+	if n := viper.GetInt("trend-checks"); n <= 0 {
+		c.trend = nil
+	} else if c.trend == nil || len(c.trend.nearest) != n {
+		c.trend = newDistanceTrend(n)
+	}
+
+	// batched notifications can be sent from outside a check
+	c.batchMu.Lock()
+	c.notifyClient, c.notifiers, c.typeMap = client, notifiers, mappings
+	c.batchMu.Unlock()
+
+	return nil
+}
+
+// withSettings runs fn once any check in progress is done. The settings are only read from
+// checks, or through here, so a reload changing them from here can't race anything reading
+// them.
+func (c *Checker) withSettings(fn func()) {
+	c.checkMu.Lock()
+	defer c.checkMu.Unlock()
+
+	fn()
+}
+
+func (c *Checker) Check(ctx context.Context) (result *CheckResult, err error) {
+	c.checkMu.Lock()
+	defer c.checkMu.Unlock()
+
+	ctx, span := tracer.Start(ctx, "Check", trace.WithAttributes(
+		attribute.Float64("distance", c.Distance/distanceUnits[c.Unit]),
+		attribute.String("distance_unit", c.Unit),
+	))
+	defer func() {
+		if result != nil {
+			span.SetAttributes(
+				attribute.Int("available", result.Available),
+				attribute.Int("nearby", result.Nearby),
+				attribute.Int("new", result.New),
+			)
+		}
+		endSpan(span, err)
+	}()
+
+	// with --quiet-when-empty we can't know yet whether this check is worth mentioning,
+	// so the summary has to stand on its own
+	start := c.log.Info()
+	if viper.GetBool("quiet-when-empty") {
+		start = c.log.Debug()
+	}
+	start.Msg("checking for appointments")
+	checksTotal.Inc()
+
+	searchCtx, searchSpan := tracer.Start(ctx, "search")
+	fc, total, err := c.source.Fetch(searchCtx, c.available)
+	searchSpan.SetAttributes(attribute.Int("locations", total))
+	endSpan(searchSpan, err)
+
+	if fc == nil {
+		return nil, err
+	}
+	c.setLastSuccess(time.Now())
+
+	handleCtx, handleSpan := tracer.Start(ctx, "handle")
+	// some searches failing still leaves the rest worth handling
+	result, herr := c.handle(handleCtx, fc, total, err != nil)
+	endSpan(handleSpan, herr)
+
+	if herr != nil {
+		err = multierror.Append(err, herr)
+	}
+	return result, err
+}
+
+// LastSuccess is when we last got a valid response from the search.
+func (c *Checker) LastSuccess() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lastSuccess
+}
+
+func (c *Checker) setLastSuccess(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lastSuccess = t
+}
+
+// retryDelay doubles base for each attempt, capped at max, then jitters it so that
+// everyone retrying after an outage doesn't hit the upstream at the same moment.
+func retryDelay(attempt int, base, max time.Duration) time.Duration {
+	delay := base << uint(attempt)
+	if delay <= 0 || delay > max {
+		// also catches overflow
+		delay = max
+	}
+	if delay <= 0 {
+		return 0
+	}
+	half := delay / 2
+
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// available is whether f has appointments we'd want, wherever it is. Sources call it as
+// they decode, so only these are kept in memory. It may be called concurrently.
+func (c *Checker) available(f *geojson.Feature) bool {
+	if !f.Properties.MustBool(viper.GetString("appointments-available-field"), false) {
+		return false
+	}
+
+	if !viper.GetBool("include-second-dose-only") && f.Properties.MustBool(viper.GetString("second-dose-only-field"), false) {
+		return false
+	}
+
+	c.checkAppointmentsShape(f)
+
+	if !matchesVaccineTypes(f, viper.GetStringSlice("vaccine-types"), c.typeMap) {
+		return false
+	}
+
+	if !matchesProvider(f, viper.GetStringSlice("provider-include"), viper.GetStringSlice("provider-exclude")) {
+		return false
+	}
+
+	if !matchesCity(f, viper.GetStringSlice("cities"), viper.GetStringSlice("exclude-cities")) {
+		return false
+	}
+
+	if c.window.active() && filterAppointments(f, c.window, viper.GetString("time-layout")) == 0 {
+		return false
+	}
+
+	return appointmentCount(f, viper.GetInt("unlisted-appointments")) >= viper.GetInt("min-appointments")
 }
 
-func handle(ctx context.Context, location orb.Point, distance float64, fc *geojson.FeatureCollection) error {
+// handle works through the available sites fc, out of total locations searched. partial is
+// whether some of the searches failed, so sites missing from fc may only be missing from
+// those.
+func (c *Checker) handle(ctx context.Context, fc *geojson.FeatureCollection, total int, partial bool) (*CheckResult, error) {
 	var (
-		available uint64
+		available int
 		found     []*geojson.Feature
+		foundNew  []*geojson.Feature
+		seen      = make(map[string]struct{}, len(fc.Features))
+		cutoff    = time.Now().Add(-viper.GetDuration("max-appointment-age"))
 	)
 
 	for _, f := range fc.Features {
-		if !f.Properties.MustBool("appointments_available", false) {
+		// done here rather than as the sites are decoded, since a response reused because
+		// it hasn't changed can still have gone stale
+		if viper.GetBool("skip-past") && !dropPast(f, cutoff, viper.GetString("time-layout")) {
+			c.log.Debug().Int("id", featureID(f)).Msg("dropping site with only past appointments")
 			continue
 		}
+		// the upstream occasionally lists a site twice, and overlapping searches can turn
+		// up the same one again
+		if key := featureKey(f); key != "" {
+			if _, dup := seen[key]; dup {
+				c.log.Debug().Str("key", key).Msg("dropping duplicate site")
+				continue
+			}
+			seen[key] = struct{}{}
+		}
+		available++
 
-		if !viper.GetBool("include-second-dose-only") && f.Properties.MustBool("appointments_available_2nd_dose_only", false) {
+		// everything downstream works on found, so this is the only place that needs to check
+		p, ok := f.Geometry.(orb.Point)
+		if !ok {
+			c.log.Debug().Int("id", featureID(f)).Msgf("skipping site with %T geometry", f.Geometry)
 			continue
 		}
-		available++
 
-		if geo.Distance(f.Geometry.(orb.Point), location) <= distance {
-			printFeature(f, location)
+		if c.nearby(f, p) && c.matchesFilter(f, p) {
 			found = append(found, f)
+
+			if !c.alreadyFound(f) && !c.notifiedOnce(f) {
+				foundNew = append(foundNew, f)
+			}
 		}
 	}
-	fmt.Printf("found %d nearby, out of %d available from %d locations.\n", len(found), available, len(fc.Features))
+	lastAvailable.Set(float64(available))
+	lastNearby.Set(float64(len(found)))
+	c.stats.checked(found)
+
+	sortByDistance(found, c.Locations)
+	sortByDistance(foundNew, c.Locations)
+
+	result := &CheckResult{
+		Available:   available,
+		Nearby:      len(found),
+		New:         len(foundNew),
+		NewFeatures: foundNew,
+	}
+
+	listed := found
+	if viper.GetBool("summary-only") {
+		listed = nil
+	}
+
+	if jsonOutput() {
+		if err := writeCheckOutput(os.Stdout, result, listed, c.Locations, c.typeMap); err != nil {
+			return result, err
+		}
+	} else if err := printFound(listed, c.Locations, c.Unit, viper.GetInt("max-results"), c.typeMap); err != nil {
+		return result, err
+	}
+	summary := fmt.Sprintf(
+		"found %s nearby (%s new) within %.1f %s, out of %s available from %d locations, with at least %d appointments.",
+		boldCount(len(found)), boldCount(len(foundNew)), c.Distance/distanceUnits[c.Unit], c.Unit, boldCount(available), total, viper.GetInt("min-appointments"),
+	)
+	event := c.log.Info()
+	if len(found) == 0 && viper.GetBool("quiet-when-empty") {
+		event = c.log.Debug()
+	}
+	event = event.
+		Int("available", available).
+		Int("nearby", len(found)).
+		Int("new", len(foundNew)).
+		Int("min_appointments", viper.GetInt("min-appointments"))
+
+	if soonest, ok := soonestOf(found, viper.GetString("time-layout")); ok {
+		summary += " soonest: " + humanTime(soonest, time.Now())
+		event = event.Time("soonest", soonest)
+	}
+	event.Msg(summary)
+	c.trendCheck(found)
+
+	if path := viper.GetString("csv-log"); path != "" {
+		// only history, so not worth failing the check over
+		if err := appendCSVLog(path, found, c.Locations, viper.GetString("time-layout"), time.Now(), c.typeMap); err != nil {
+			c.log.Error().Err(err).Msg("error writing csv log")
+		}
+	}
+	if c.results != nil {
+		if err := c.results.record(ctx, time.Now(), result, found, c.Locations, c.typeMap); err != nil {
+			c.log.Error().Err(err).Msg("error recording results")
+		}
+	}
+
+	// what's remembered as found, which after a partial search includes the sites it may
+	// have missed, so they're neither cleared now nor new again once it's back
+	kept := found
+	if partial {
+		kept = append(kept, c.cleared(found)...)
+	}
 
-	if len(found) > 0 {
-		notify(found)
+	var cleared []*geojson.Feature
+	if viper.GetBool("notify-on-clear") && !partial {
+		cleared = c.cleared(found)
 	}
+	c.setLastFound(kept)
 
+	if !c.handled {
+		c.handled = true
+
+		if viper.GetBool("first-run-silent") {
+			c.log.Info().Int("seeded", len(foundNew)).Msgf("first check, not notifying about the %d sites already available", len(foundNew))
+			return result, nil
+		}
+	}
+
+	c.forgetDelivered(kept)
+
+	if toNotify := c.pastCooldown(foundNew, time.Now()); len(toNotify) > 0 {
+		notified, err := c.notify(withResult(ctx, result), toNotify)
+		c.recordNotified(notified, time.Now())
+		result.Notified = len(notified)
+
+		if err != nil {
+			// leave the rest pending, so the next check tries again, with just the notifiers
+			// that haven't had them yet
+			pending := without(toNotify, notified)
+			c.setLastFound(without(kept, pending))
+			c.log.Warn().Int("pending", len(pending)).Msg("notification failed, will retry on the next check")
+
+			if len(notified) > 0 {
+				err = multierror.Append(err, c.saveState(notified))
+			}
+			return result, err
+		}
+
+		if err := c.saveState(notified); err != nil {
+			return result, err
+		}
+	}
+
+	if len(cleared) > 0 {
+		if _, err := c.notify(withEvent(withResult(ctx, result), eventCleared), cleared); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// pastCooldown filters out features we've notified about within --notify-cooldown.
+func (c *Checker) pastCooldown(found []*geojson.Feature, now time.Time) []*geojson.Feature {
+	cooldown := viper.GetDuration("notify-cooldown")
+	if cooldown <= 0 {
+		return found
+	}
+
+	var ret []*geojson.Feature
+
+	for _, f := range found {
+		if at, ok := c.lastNotified[featureKey(f)]; ok && now.Sub(at) < cooldown {
+			c.log.Debug().Int("id", featureID(f)).Time("last_notified", at).Msg("skipping site still in notification cooldown")
+			continue
+		}
+		ret = append(ret, f)
+	}
+	return ret
+}
+
+// recordNotified remembers when we notified about each feature, and forgets any whose
+// cooldown has passed.
+func (c *Checker) recordNotified(notified []*geojson.Feature, now time.Time) {
+	cooldown := viper.GetDuration("notify-cooldown")
+	if cooldown <= 0 {
+		return
+	}
+
+	for key, at := range c.lastNotified {
+		if now.Sub(at) >= cooldown {
+			delete(c.lastNotified, key)
+		}
+	}
+
+	for _, f := range notified {
+		if key := featureKey(f); key != "" {
+			c.lastNotified[key] = now
+		}
+	}
+}
+
+// notify sends found to the notifiers, returning the sites every one of them has now had.
+func (c *Checker) notify(ctx context.Context, found []*geojson.Feature) (notified []*geojson.Feature, err error) {
+	ctx, span := tracer.Start(ctx, "notify", trace.WithAttributes(
+		attribute.String("event", eventFrom(ctx)),
+		attribute.Int("sites", len(found)),
+		attribute.Int("notifiers", len(c.currentNotifiers())),
+	))
+	defer func() { endSpan(span, err) }()
+
+	wait := c.throttleWait(time.Now())
+
+	if eventFrom(ctx) == eventFound {
+		if window := viper.GetDuration("notify-batch-window"); window > wait {
+			wait = window
+		}
+		if wait > 0 {
+			span.SetAttributes(attribute.Bool("batched", true))
+			c.queue(ctx, found, wait)
+			resultFrom(ctx).Queued += len(found)
+
+			// they're recorded as notified once the batch goes out
+			return nil, nil
+		}
+	} else if wait > 0 {
+		// there's no batching these with found sites, and they're only news until the next check
+		c.log.Info().Int("sites", len(found)).Msgf("%s notification within --notify-min-interval, skipping it", eventFrom(ctx))
+		return nil, nil
+	}
+	return c.send(ctx, found)
+}
+
+// send notifies every notifier at once, so a slow or failing one doesn't hold up the rest,
+// returning the sites every one of them has now had. Each notifier is only sent the found
+// sites it hasn't had yet, so when one fails, trying again doesn't repeat the others.
+func (c *Checker) send(ctx context.Context, found []*geojson.Feature) ([]*geojson.Feature, error) {
+	c.batchMu.Lock()
+	c.lastSent = time.Now()
+	notifiers, mappings := c.notifiers, c.typeMap
+	c.batchMu.Unlock()
+
+	// cleared sites are only news this once, so there's nothing to keep track of
+	track := eventFrom(ctx) == eventFound
+
+	var (
+		errs = make([]error, len(notifiers))
+		sent = make([][]*geojson.Feature, len(notifiers))
+		wg   sync.WaitGroup
+	)
+
+	for i, n := range notifiers {
+		sent[i] = found
+		if track {
+			sent[i] = c.undelivered(found, n.name)
+		}
+		if len(sent[i]) == 0 {
+			continue
+		}
+		wg.Add(1)
+
+		go func(i int, n Notifier) {
+			defer wg.Done()
+			errs[i] = c.sendTo(withTypeMap(ctx, mappings), n, sent[i])
+		}(i, n.Notifier)
+	}
+	wg.Wait()
+
+	var ret *multierror.Error
+
+	for i, err := range errs {
+		if err != nil {
+			ret = multierror.Append(ret, fmt.Errorf("%s: %w", notifiers[i].name, err))
+			continue
+		}
+		if track {
+			c.setDelivered(sent[i], notifiers[i].name)
+		}
+	}
+
+	if !track {
+		if ret != nil {
+			return nil, ret
+		}
+		return found, nil
+	}
+
+	var notified []*geojson.Feature
+
+	for _, f := range found {
+		if c.deliveredToAll(f, notifiers) {
+			notified = append(notified, f)
+			delete(c.delivered, featureKey(f))
+		}
+	}
+	return notified, ret.ErrorOrNil()
+}
+
+// undelivered is the sites in found that n hasn't had yet.
+func (c *Checker) undelivered(found []*geojson.Feature, name string) []*geojson.Feature {
+	var ret []*geojson.Feature
+
+	for _, f := range found {
+		if !c.delivered[featureKey(f)][name] {
+			ret = append(ret, f)
+		}
+	}
+	return ret
+}
+
+func (c *Checker) setDelivered(sent []*geojson.Feature, name string) {
+	for _, f := range sent {
+		key := featureKey(f)
+		if key == "" {
+			// nothing to remember it by
+			continue
+		}
+		if c.delivered[key] == nil {
+			c.delivered[key] = map[string]bool{}
+		}
+		c.delivered[key][name] = true
+	}
+}
+
+func (c *Checker) deliveredToAll(f *geojson.Feature, notifiers []namedNotifier) bool {
+	key := featureKey(f)
+	if key == "" {
+		// sent to everyone in one go, or it would have failed
+		return true
+	}
+	for _, n := range notifiers {
+		if !c.delivered[key][n.name] {
+			return false
+		}
+	}
+	return true
+}
+
+// forgetDelivered drops what's kept about the pending sites that aren't in found any more,
+// so if they come back, they're news to every notifier again. Sites still waiting in a batch
+// are kept, so the batch going out again doesn't repeat them to the notifiers that had them.
+func (c *Checker) forgetDelivered(found []*geojson.Feature) {
+	keys, batched := featureKeys(found), c.batchKeys()
+
+	for key := range c.delivered {
+		_, ok := keys[key]
+		_, waiting := batched[key]
+
+		if !ok && !waiting {
+			delete(c.delivered, key)
+		}
+	}
+}
+
+// TestNotify sends a made-up site at the first location through each notifier, as though a
+// check had just found it, returning each one's error by notifier name.
+func (c *Checker) TestNotify(ctx context.Context) map[string]error {
+	c.checkMu.Lock()
+	defer c.checkMu.Unlock()
+
+	f := geojson.NewFeature(c.Locations[0])
+	f.Properties["id"] = 0
+	f.Properties["provider_brand_name"] = "Test Pharmacy"
+	f.Properties["address"] = "1 Test St"
+	f.Properties["city"] = "Testville"
+	f.Properties["state"] = "NJ"
+	f.Properties[viper.GetString("appointments-available-field")] = true
+	f.Properties[viper.GetString("appointments-field")] = []interface{}{
+		map[string]interface{}{"time": time.Now().Add(time.Hour).Format(viper.GetString("time-layout")), "type": "Pfizer - 1st Dose"},
+	}
+
+	var (
+		found = []*geojson.Feature{f}
+		ret   = map[string]error{}
+	)
+	ctx = withEvent(withResult(ctx, &CheckResult{Available: 1, Nearby: 1, New: 1, NewFeatures: found}), eventFound)
+	ctx = withTypeMap(ctx, c.typeMap)
+
+	for _, n := range c.currentNotifiers() {
+		ret[n.name] = c.sendTo(ctx, n.Notifier, found)
+	}
+	return ret
+}
+
+func (c *Checker) currentNotifiers() []namedNotifier {
+	c.batchMu.Lock()
+	defer c.batchMu.Unlock()
+
+	return c.notifiers
+}
+
+// sendTo notifies n about found, retrying failures with backoff.
+func (c *Checker) sendTo(ctx context.Context, n Notifier, found []*geojson.Feature) error {
+	if _, ok := n.(nopNotifier); ok {
+		// nothing gets sent, so there's nothing to retry or count
+		return nil
+	}
+	var (
+		err     error
+		retries = viper.GetInt("notification-retries")
+	)
+
+	for attempt := 0; ; attempt++ {
+		if err = n.Notify(c.log.WithContext(ctx), found); err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if attempt >= retries {
+			return fmt.Errorf("error notifying after %d attempts: %w", attempt+1, err)
+		}
+
+		delay := retryDelay(attempt, viper.GetDuration("notification-retry-delay"), viper.GetDuration("check-interval"))
+		c.log.Warn().Err(err).Dur("delay", delay).Msgf("error notifying, retrying in %v", delay.Round(time.Millisecond))
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+	notificationsTotal.Inc()
+	c.stats.notified()
+
+	return nil
+}
+
+// without returns the features in all that aren't in remove.
+func without(all, remove []*geojson.Feature) []*geojson.Feature {
+	var ret []*geojson.Feature
+
+	for _, f := range all {
+		var removed bool
+
+		for _, r := range remove {
+			if f == r {
+				removed = true
+				break
+			}
+		}
+		if !removed {
+			ret = append(ret, f)
+		}
+	}
+	return ret
+}
+
+func (c *Checker) setLastFound(found []*geojson.Feature) {
+	c.lastFound = found
+	c.lastKeys = featureKeys(found)
+}
+
+func (c *Checker) alreadyFound(f *geojson.Feature) bool {
+	return hasFeature(c.lastKeys, f)
+}
+
+// notifiedOnce is whether f has ever been notified about, with --notify-once-per-site.
+func (c *Checker) notifiedOnce(f *geojson.Feature) bool {
+	if c.state == nil || !viper.GetBool("notify-once-per-site") {
+		return false
+	}
+	key := featureKey(f)
+	if key == "" {
+		return false
+	}
+	_, ok := c.state.Notified[key]
+	return ok
+}
+
+// cleared returns the sites found last time that aren't in found any more.
+func (c *Checker) cleared(found []*geojson.Feature) []*geojson.Feature {
+	var (
+		ret  []*geojson.Feature
+		keys = featureKeys(found)
+	)
+
+	for _, lf := range c.lastFound {
+		if featureKey(lf) != "" && !hasFeature(keys, lf) {
+			ret = append(ret, lf)
+		}
+	}
+	return ret
+}
+
+// featureKeys returns the set of featureKey for features, for hasFeature.
+func featureKeys(features []*geojson.Feature) map[string]struct{} {
+	ret := make(map[string]struct{}, len(features))
+
+	for _, f := range features {
+		if key := featureKey(f); key != "" {
+			ret[key] = struct{}{}
+		}
+	}
+	return ret
+}
+
+func hasFeature(keys map[string]struct{}, f *geojson.Feature) bool {
+	key := featureKey(f)
+	if key == "" {
+		// nothing to compare by, so treat it as different
+		return false
+	}
+
+	_, ok := keys[key]
+	return ok
+}
+
+func (c *Checker) saveState(notified []*geojson.Feature) error {
+	if c.state == nil || len(notified) == 0 || viper.GetBool("dry-run") {
+		return nil
+	}
+
+	var keys []string
+
+	for _, f := range notified {
+		if key := featureKey(f); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	c.state.record(keys, time.Now())
+
+	if err := c.state.save(); err != nil {
+		return fmt.Errorf("error saving state: %w", err)
+	}
 	return nil
 }
 
-func printFeature(f *geojson.Feature, location orb.Point) {
-	fmt.Printf(
-		"%s - %s, %s, %s - %.2f km\n",
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func featureID(f *geojson.Feature) int {
+	return f.Properties.MustInt("id", -1)
+}
+
+// featureKey identifies f by its id, or failing that by where it is, so feeds without ids
+// don't re-report the same sites every check. It's empty if there's nothing to go on.
+func featureKey(f *geojson.Feature) string {
+	if id := featureID(f); id != -1 {
+		return fmt.Sprintf("id:%d", id)
+	}
+
+	var parts []string
+
+	for _, k := range []string{"provider_brand_name", "address", "postal_code"} {
+		if v := strings.ToLower(strings.Join(strings.Fields(f.Properties.MustString(k, "")), " ")); v != "" {
+			parts = append(parts, v)
+		}
+	}
+	if len(parts) > 1 {
+		return "site:" + strings.Join(parts, "|")
+	}
+
+	if p, ok := f.Geometry.(orb.Point); ok {
+		// about 10m
+		return fmt.Sprintf("point:%.4f,%.4f", p.Lon(), p.Lat())
+	}
+	return ""
+}
+
+// printFound prints up to max features, or all of them if max is zero.
+func printFound(found []*geojson.Feature, locations orb.MultiPoint, unit string, max int, mappings []typeMapping) error {
+	if len(found) == 0 {
+		return nil
+	}
+
+	t, err := lineTemplate()
+	if err != nil {
+		return fmt.Errorf("invalid --line-template: %w", err)
+	}
+
+	for i, f := range found {
+		if max > 0 && i >= max {
+			fmt.Printf("...and %d more\n\n", len(found)-max)
+			break
+		}
+		if err := printFeature(t, f, locations, unit, mappings); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortByDistance(features []*geojson.Feature, locations orb.MultiPoint) {
+	sort.SliceStable(features, func(i, j int) bool {
+		return nearestDistance(features[i].Geometry.(orb.Point), locations) < nearestDistance(features[j].Geometry.(orb.Point), locations)
+	})
+}
+
+// nearestDistance is how far p is from the closest of locations, in meters.
+func nearestDistance(p orb.Point, locations orb.MultiPoint) float64 {
+	nearest := math.Inf(1)
+
+	for _, l := range locations {
+		if d := pointDistance(p, l); d < nearest {
+			nearest = d
+		}
+	}
+	return nearest
+}
+
+// printFeature prints f in green if it's within --close-distance, or yellow otherwise,
+// when coloring output.
+func printFeature(t *template.Template, f *geojson.Feature, locations orb.MultiPoint, unit string, mappings []typeMapping) error {
+	var b bytes.Buffer
+
+	if viper.GetBool("verbose") {
+		writeFeatureVerbose(&b, f, locations, unit)
+	} else if err := writeFeature(&b, t, f, locations, unit, mappings); err != nil {
+		return err
+	}
+
+	color := ansiYellow
+	if nearestDistance(f.Geometry.(orb.Point), locations) <= closeDistance(unit) {
+		color = ansiGreen
+	}
+	fmt.Println(colorize(b.String(), color))
+
+	return nil
+}
+
+// writeFeature writes f with the line template, by default a line describing it followed
+// by a line for each appointment.
+func writeFeature(w io.Writer, t *template.Template, f *geojson.Feature, locations orb.MultiPoint, unit string, mappings []typeMapping) error {
+	if err := t.Execute(w, newLineData(f, locations, unit, mappings)); err != nil {
+		return fmt.Errorf("error rendering line-template: %w", err)
+	}
+	return nil
+}
+
+// writeFeatureVerbose is writeFeature with every property and appointment field, for
+// finding out what the upstream is sending.
+func writeFeatureVerbose(w io.Writer, f *geojson.Feature, locations orb.MultiPoint, unit string) {
+	fmt.Fprintln(w, featureSummary(f, locations, unit))
+
+	props := make(map[string]interface{}, len(f.Properties))
+	for k, v := range f.Properties {
+		if k != viper.GetString("appointments-field") {
+			props[k] = v
+		}
+	}
+	writeFields(w, "  ", props)
+
+	for i, fields := range sortedAppointments(f, viper.GetString("time-layout")) {
+		fmt.Fprintf(w, "  appointment %d:\n", i+1)
+		writeFields(w, "    ", fields)
+	}
+}
+
+func writeFields(w io.Writer, indent string, fields map[string]interface{}) {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s%s: %v\n", indent, k, fields[k])
+	}
+}
+
+// displayTime is the appointment's time in --display-timezone, formatted with
+// --time-output-layout if it's set, or else --time-layout and the zone's abbreviation. Times
+// that can't be parsed are shown as the upstream sent them.
+func displayTime(fields map[string]interface{}) interface{} {
+	t, ok := appointmentTime(fields, viper.GetString("time-layout"))
+	if !ok {
+		return mapString(fields, "time", "(unknown time)")
+	}
+	if loc, err := loadLocation(viper.GetString("display-timezone")); err == nil {
+		t = t.In(loc)
+	}
+
+	if layout := viper.GetString("time-output-layout"); layout != "" {
+		return t.Format(layout)
+	}
+	return t.Format(viper.GetString("time-layout")) + " " + t.Format("MST")
+}
+
+// soonestOf is the time of the earliest appointment at any of found.
+func soonestOf(found []*geojson.Feature, layout string) (time.Time, bool) {
+	var soonest time.Time
+
+	for _, f := range found {
+		if t, ok := soonestTime(f, layout); ok && (soonest.IsZero() || t.Before(soonest)) {
+			soonest = t
+		}
+	}
+	return soonest, !soonest.IsZero()
+}
+
+// soonestTime is the time of f's earliest appointment, if it lists any with a time we can
+// parse.
+func soonestTime(f *geojson.Feature, layout string) (time.Time, bool) {
+	var soonest time.Time
+
+	for _, fields := range featureAppointments(f) {
+		if t, ok := appointmentTime(fields, layout); ok && (soonest.IsZero() || t.Before(soonest)) {
+			soonest = t
+		}
+	}
+	return soonest, !soonest.IsZero()
+}
+
+// humanTime describes t relative to now, in --display-timezone, like "tomorrow 9:15am".
+func humanTime(t, now time.Time) string {
+	if loc, err := loadLocation(viper.GetString("display-timezone")); err == nil {
+		t, now = t.In(loc), now.In(loc)
+	}
+
+	var (
+		clock = t.Format("3:04pm")
+		day   = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+		today = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	)
+
+	switch days := int(day.Sub(today).Hours() / 24); {
+	case days == 0:
+		return "today " + clock
+	case days == 1:
+		return "tomorrow " + clock
+	case days > 1 && days < 7:
+		return t.Format("Mon ") + clock
+	case t.Year() == now.Year():
+		return t.Format("Jan 2 ") + clock
+	}
+	return t.Format("Jan 2 2006 ") + clock
+}
+
+// sortedAppointments is featureAppointments soonest first, with any whose time can't be
+// parsed with layout left at the end in their original order.
+func sortedAppointments(f *geojson.Feature, layout string) []map[string]interface{} {
+	appts := featureAppointments(f)
+
+	sort.SliceStable(appts, func(i, j int) bool {
+		ti, iok := appointmentTime(appts[i], layout)
+		tj, jok := appointmentTime(appts[j], layout)
+
+		if iok && jok {
+			return ti.Before(tj)
+		}
+		return iok && !jok
+	})
+	return appts
+}
+
+// appointmentCount is how many appointments f lists, or how many it says it has if it only
+// gives a count, or else unlisted if it says it has some without giving any detail.
+func appointmentCount(f *geojson.Feature, unlisted int) int {
+	appts, count, _ := parseAppointments(f.Properties[viper.GetString("appointments-field")])
+
+	switch {
+	case len(appts) > 0:
+		return len(appts)
+	case count > 0:
+		return count
+	}
+	return unlisted
+}
+
+// featureSummary describes f on a single line, with its distance from the nearest of locations.
+func featureSummary(f *geojson.Feature, locations orb.MultiPoint, unit string) string {
+	return fmt.Sprintf(
+		"%s - %s, %s, %s - %.2f %s",
 		f.Properties.MustString("provider_brand_name", "(unknown name)"),
 		f.Properties.MustString("address", "(unknown address)"),
 		f.Properties.MustString("city", "(unknown city)"),
 		f.Properties.MustString("state", "(unknown state)"),
-		geo.Distance(f.Geometry.(orb.Point), location)/1000.0,
+		nearestDistance(f.Geometry.(orb.Point), locations)/distanceUnits[unit],
+		unit,
 	)
-	if prop, ok := f.Properties["appointments"]; ok {
-		if appts, ok := prop.([]interface{}); ok {
-			for _, appt := range appts {
-				if fields, ok := appt.(map[string]interface{}); ok {
-					fmt.Printf(
-						"  %v: %v\n",
-						mapString(fields, "time", "(unknown time)"),
-						mapString(fields, "type", "(unknown type)"),
-					)
-					// for k, v := range fields {
-					// 	fmt.Printf("  %s: %v\n", k, v)
-					// }
+}
+
+// matchesVaccineTypes reports whether f offers any of types, matching case-insensitively
+// against the vaccine types and appointment type/vaccine fields. Features that don't say
+// which vaccines they have are given the benefit of the doubt.
+func matchesVaccineTypes(f *geojson.Feature, types []string, mappings []typeMapping) bool {
+	if len(types) == 0 {
+		return true
+	}
+	var known bool
+
+	if prop, ok := f.Properties["appointment_vaccine_types"].(map[string]interface{}); ok {
+		for name, offered := range prop {
+			if b, ok := offered.(bool); ok && b {
+				known = true
+
+				if containsAny(name, types) || containsAny(normalizeType(name, mappings).Vaccine, types) {
+					return true
+				}
+			}
+		}
+	}
+
+	for _, fields := range featureAppointments(f) {
+		for _, key := range []string{"type", "vaccine"} {
+			if value, ok := mapString(fields, key, nil).(string); ok && value != "" {
+				known = true
+
+				if containsAny(value, types) || containsAny(normalizeType(value, mappings).Vaccine, types) {
+					return true
 				}
 			}
 		}
 	}
-	fmt.Println()
+	return !known
+}
+
+// nearby checks f, at p, against the distance and any --zip-codes, either of which will do
+// unless --zip-codes-and-distance is set. Nothing closer than the minimum distance is nearby.
+func (c *Checker) nearby(f *geojson.Feature, p orb.Point) bool {
+	d := nearestDistance(p, c.Locations)
+	if d < c.MinDistance {
+		return false
+	}
+	inRange := d <= c.Distance
+
+	zips := viper.GetStringSlice("zip-codes")
+	if len(zips) == 0 {
+		return inRange
+	}
+
+	if viper.GetBool("zip-codes-and-distance") {
+		return inRange && matchesZipCode(f, zips)
+	}
+	return inRange || matchesZipCode(f, zips)
+}
+
+// matchesZipCode checks the postal code against zips, ignoring any ZIP+4 suffix.
+func matchesZipCode(f *geojson.Feature, zips []string) bool {
+	code := f.Properties.MustString("postal_code", "")
+	if code == "" {
+		return false
+	}
+	if i := strings.Index(code, "-"); i >= 0 {
+		code = code[:i]
+	}
+	return equalsAny(code, zips)
+}
+
+// matchesProvider checks the provider brand against include, if given, or else exclude.
+func matchesProvider(f *geojson.Feature, include, exclude []string) bool {
+	name := f.Properties.MustString("provider_brand_name", "")
+
+	if len(include) > 0 {
+		return equalsAny(name, include)
+	}
+	return !equalsAny(name, exclude)
+}
+
+// matchesCity checks the city against include, if given, and exclude. Sites that don't
+// say which city they're in only match if there's no include list.
+func matchesCity(f *geojson.Feature, include, exclude []string) bool {
+	city := f.Properties.MustString("city", "")
+
+	if len(include) > 0 && (city == "" || !equalsAny(city, include)) {
+		return false
+	}
+	return city == "" || !equalsAny(city, exclude)
+}
+
+func equalsAny(s string, values []string) bool {
+	for _, v := range values {
+		if strings.EqualFold(strings.TrimSpace(s), strings.TrimSpace(v)) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(s string, substrs []string) bool {
+	s = strings.ToLower(s)
+
+	for _, sub := range substrs {
+		if sub != "" && strings.Contains(s, strings.ToLower(sub)) {
+			return true
+		}
+	}
+	return false
 }
 
 func mapString(m map[string]interface{}, key string, fallback interface{}) interface{} {
@@ -107,51 +1218,182 @@ func mapString(m map[string]interface{}, key string, fallback interface{}) inter
 	return fallback
 }
 
-func notify(found []*geojson.Feature) error {
-	if viper.GetBool("silent") {
-		return nil
+// sendNotification sends req with client and returns the response body, or prints it and returns
+// a nil body under --dry-run.
+func sendNotification(ctx context.Context, client *http.Client, req *http.Request) ([]byte, error) {
+	if viper.GetBool("dry-run") {
+		return nil, printRequest(req)
 	}
-	req, err := http.NewRequest(viper.GetString("notification-method"), notificationURL(), body())
+	zerolog.Ctx(ctx).Info().Str("url", redactSecrets(req.URL.Redacted())).Msg("notifying")
+
+	resp, err := client.Do(req)
 	if err != nil {
-		return fmt.Errorf("error creating request: %w", err)
+		// the error includes the URL, which can have a token in it
+		return nil, fmt.Errorf("error notifying: %s", redactSecrets(err.Error()))
 	}
-	fmt.Printf("notifying at %s\n", time.Now().Format(time.RFC1123))
+	defer resp.Body.Close()
 
-	resp, err := http.DefaultClient.Do(req)
+	b, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return fmt.Errorf("error notifying: %v", err)
+		return nil, fmt.Errorf("error reading notification response: %w", err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("%w: %s", errInvalidStatusReturned, resp.Status)
+	// validated at startup
+	if ok, _ := successStatus(resp.StatusCode, viper.GetStringSlice("notification-success-codes")); !ok {
+		return nil, fmt.Errorf("%w: %s: %s", errInvalidStatusReturned, resp.Status, snippet([]byte(redactSecrets(string(b)))))
 	}
+	return b, nil
+}
 
-	if b, err := ioutil.ReadAll(resp.Body); err == nil {
-		fmt.Println(string(b))
+// successStatus is whether code is one of codes, each a status like 201, a range like
+// 200-204 or a class like 2xx.
+func successStatus(code int, codes []string) (bool, error) {
+	var ret bool
+
+	for _, c := range codes {
+		c = strings.ToLower(strings.TrimSpace(c))
+		lo, hi := c, c
+
+		switch {
+		case len(c) == 3 && strings.HasSuffix(c, "xx"):
+			lo, hi = c[:1]+"00", c[:1]+"99"
+		case strings.Contains(c, "-"):
+			i := strings.Index(c, "-")
+			lo, hi = strings.TrimSpace(c[:i]), strings.TrimSpace(c[i+1:])
+		}
+
+		from, err1 := strconv.Atoi(lo)
+		to, err2 := strconv.Atoi(hi)
+		if err1 != nil || err2 != nil || from < 100 || to > 599 || from > to {
+			return false, fmt.Errorf("%w: %s", errInvalidSuccessCodes, c)
+		}
+		ret = ret || (code >= from && code <= to)
+	}
+	return ret, nil
+}
+
+// printRequest shows what would have been sent for req, without consuming its body.
+func printRequest(req *http.Request) error {
+	w := textOut()
+
+	fmt.Fprintf(w, "dry run, would notify at %s with:\n", time.Now().Format(time.RFC1123))
+	fmt.Fprintf(w, "%s %s\n", req.Method, redactSecrets(req.URL.Redacted()))
+
+	for _, h := range debugHeaders(req.Header) {
+		fmt.Fprintln(w, h)
 	}
+
+	if req.GetBody != nil {
+		rc, err := req.GetBody()
+		if err != nil {
+			return fmt.Errorf("error reading request body: %w", err)
+		}
+		defer rc.Close()
+
+		b, err := ioutil.ReadAll(rc)
+		if err != nil {
+			return fmt.Errorf("error reading request body: %w", err)
+		}
+		fmt.Fprintf(w, "\n%s\n", redactSecrets(string(b)))
+	}
+	fmt.Fprintln(w)
+
 	return nil
 }
 
-func searchURL() string {
-	var params []interface{}
+// newRequest creates a request, sending params in the body for methods that take one.
+// headers are key:value pairs, and replace any default header with the same key.
+func newRequest(ctx context.Context, method, target string, params []string, contentType string, headers []string) (*http.Request, error) {
+	var b io.Reader
+
+	if paramsInBody(method) {
+		var err error
 
-	for _, s := range viper.GetStringSlice("search-params") {
-		params = append(params, s)
+		if b, err = buildBody(params, contentType); err != nil {
+			return nil, err
+		}
 	}
-	return fmt.Sprintf(viper.GetString("search-url-pattern"), params...)
+	return newRequestWithBody(ctx, method, target, b, contentType, headers)
 }
 
-func notificationURL() string {
-	ret := viper.GetString("notification-url")
+// newRequestWithBody creates a request sending b, if it's not nil, as contentType.
+func newRequestWithBody(ctx context.Context, method, target string, b io.Reader, contentType string, headers []string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, b)
+	if err != nil {
+		return nil, err
+	}
+	if b != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("User-Agent", userAgent)
 
-	if params := viper.GetStringSlice("notification-params"); len(params) > 0 {
-		ret += "?" + strings.Join(params, "&")
+	h, err := parseHeaders(headers)
+	if err != nil {
+		return nil, err
 	}
-	return ret
+	for k, values := range h {
+		req.Header[k] = values
+	}
+	return req, nil
 }
 
-func body() io.Reader {
-	// TODO: construct body from viper.GetString("notification-params")
-	return nil
+// parseHeaders parses key:value pairs, allowing a key to be repeated for multiple values.
+func parseHeaders(headers []string) (http.Header, error) {
+	ret := http.Header{}
+
+	for _, header := range headers {
+		parts := strings.SplitN(header, ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("%w: %q", errInvalidHeader, header)
+		}
+		ret.Add(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+	}
+	return ret, nil
+}
+
+func paramsInBody(method string) bool {
+	return strings.EqualFold(method, http.MethodPost)
+}
+
+// buildBody encodes key=value params as either a form or a JSON object.
+func buildBody(params []string, contentType string) (io.Reader, error) {
+	switch contentType {
+	case contentTypeForm:
+		values := url.Values{}
+
+		for _, p := range params {
+			k, v, err := splitParam(p)
+			if err != nil {
+				return nil, err
+			}
+			values.Add(k, v)
+		}
+		return strings.NewReader(values.Encode()), nil
+
+	case contentTypeJSON:
+		values := map[string]string{}
+
+		for _, p := range params {
+			k, v, err := splitParam(p)
+			if err != nil {
+				return nil, err
+			}
+			values[k] = v
+		}
+		b, err := json.Marshal(values)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(b), nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", errInvalidContentType, contentType)
+}
+
+func splitParam(p string) (string, string, error) {
+	parts := strings.SplitN(p, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", "", fmt.Errorf("%w: %q", errInvalidParam, p)
+	}
+	return parts[0], parts[1], nil
 }
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+func TestBuildBodyForm(t *testing.T) {
+	r, err := buildBody([]string{"zip=07030", "radius=10", "zip=07302"}, contentTypeForm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(r)
+
+	got, err := url.ParseQuery(string(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := url.Values{"zip": {"07030", "07302"}, "radius": {"10"}}
+
+	if got.Encode() != want.Encode() {
+		t.Errorf("got %s, want %s", got.Encode(), want.Encode())
+	}
+}
+
+func TestBuildBodyJSON(t *testing.T) {
+	r, err := buildBody([]string{"zip=07030", "query=a=b"}, contentTypeJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got map[string]string
+	if err := json.NewDecoder(r).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got["zip"] != "07030" || got["query"] != "a=b" {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestBuildBodyErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		params      []string
+		contentType string
+		want        error
+	}{
+		{"no equals", []string{"zip"}, contentTypeForm, errInvalidParam},
+		{"no key", []string{"=07030"}, contentTypeJSON, errInvalidParam},
+		{"content type", []string{"zip=07030"}, "text/plain", errInvalidContentType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := buildBody(tt.params, tt.contentType); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckResultCounts(t *testing.T) {
+	unavailable := testSite(4, orb.Point{-74.01, 40.71})
+	unavailable.Properties["appointments_available"] = false
+
+	source := &memorySource{features: []*geojson.Feature{
+		testSite(2, orb.Point{-74.05, 40.75}),
+		testSite(1, orb.Point{-74.01, 40.71}),
+		testSite(3, orb.Point{-75.0, 41.5}), // over 100km away
+		unavailable,
+	}}
+	c := newTestChecker(t, source, nil)
+
+	result, err := c.Check(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Available != 3 || result.Nearby != 2 || result.New != 2 {
+		t.Errorf("got %d available, %d nearby, %d new, want 3, 2, 2", result.Available, result.Nearby, result.New)
+	}
+
+	var ids []int
+	for _, f := range result.NewFeatures {
+		ids = append(ids, featureID(f))
+	}
+	// nearest first
+	if len(ids) != 2 || ids[0] != 1 || ids[1] != 2 {
+		t.Errorf("got new features %v, want [1 2]", ids)
+	}
+}
+
+func TestCheckNonPointGeometry(t *testing.T) {
+	source := &memorySource{features: []*geojson.Feature{
+		testSite(1, orb.Point{-74.01, 40.71}),
+		testSite(2, orb.LineString{{-74.01, 40.71}, {-74.02, 40.72}}),
+		testSite(3, nil),
+	}}
+	c := newTestChecker(t, source, map[string]interface{}{"filter": "distance < 10"})
+
+	result, err := c.Check(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Available != 3 || result.Nearby != 1 {
+		t.Errorf("got %d available, %d nearby, want 3, 1", result.Available, result.Nearby)
+	}
+}
+
+func TestAlreadyFound(t *testing.T) {
+	site := func(props map[string]interface{}, g orb.Geometry) *geojson.Feature {
+		f := geojson.NewFeature(g)
+		for k, v := range props {
+			f.Properties[k] = v
+		}
+		return f
+	}
+	here := orb.Point{-74.01, 40.71}
+
+	var c Checker
+	c.setLastFound([]*geojson.Feature{
+		site(map[string]interface{}{"id": 1.0, "provider_brand_name": "CVS", "address": "1 Main"}, here),
+		site(map[string]interface{}{"provider_brand_name": "Walgreens", "address": "2 Elm St"}, here),
+		site(map[string]interface{}{"provider_brand_name": "Rite Aid"}, nil),
+		site(nil, orb.Point{-74.02, 40.72}),
+	})
+
+	tests := []struct {
+		name string
+		f    *geojson.Feature
+		want bool
+	}{
+		{"same id", site(map[string]interface{}{"id": 1.0}, nil), true},
+		{"other id, same site", site(map[string]interface{}{"id": 2.0, "provider_brand_name": "CVS", "address": "1 Main"}, here), false},
+		{"no id, same site", site(map[string]interface{}{"provider_brand_name": "walgreens", "address": " 2  elm st"}, nil), true},
+		{"id of -1 is no id", site(map[string]interface{}{"id": -1.0, "provider_brand_name": "Walgreens", "address": "2 Elm St"}, nil), true},
+		{"no id, other site", site(map[string]interface{}{"provider_brand_name": "Walgreens", "address": "3 Oak"}, here), false},
+		{"no id, same point", site(nil, orb.Point{-74.02001, 40.72001}), true},
+		{"nothing to go on", site(map[string]interface{}{"provider_brand_name": "Rite Aid"}, nil), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.alreadyFound(tt.f); got != tt.want {
+				t.Errorf("got %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+// BenchmarkAlreadyFound looks each of a large check's sites up in the one before it, by
+// the set kept by setLastFound and by scanning lastFound as it was done before that.
+func BenchmarkAlreadyFound(b *testing.B) {
+	setConfig(b, nil)
+
+	found := make([]*geojson.Feature, 5000)
+	for i := range found {
+		found[i] = testSite(i, orb.Point{-74.0, 40.7})
+	}
+
+	var c Checker
+	c.setLastFound(found)
+
+	b.Run("set", func(b *testing.B) {
+		b.ReportAllocs()
+
+		for i := 0; i < b.N; i++ {
+			for _, f := range found {
+				if !c.alreadyFound(f) {
+					b.Fatal("site not found")
+				}
+			}
+		}
+	})
+
+	b.Run("scan", func(b *testing.B) {
+		b.ReportAllocs()
+
+		for i := 0; i < b.N; i++ {
+			for _, f := range found {
+				key, ok := featureKey(f), false
+				for _, lf := range c.lastFound {
+					if featureKey(lf) == key {
+						ok = true
+						break
+					}
+				}
+				if !ok {
+					b.Fatal("site not found")
+				}
+			}
+		}
+	})
+}
+
+func TestCheckDedupes(t *testing.T) {
+	byName := func(id int) *geojson.Feature {
+		f := testSite(id, orb.Point{-74.02, 40.72})
+		delete(f.Properties, "id")
+		f.Properties["address"] = "2 Elm"
+		return f
+	}
+
+	source := &memorySource{features: []*geojson.Feature{
+		testSite(1, orb.Point{-74.01, 40.71}),
+		testSite(1, orb.Point{-74.01, 40.71}),
+		byName(2),
+		byName(3),
+		testSite(4, orb.Point{-74.03, 40.73}),
+	}}
+	c := newTestChecker(t, source, nil)
+
+	result, err := c.Check(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Available != 3 || result.Nearby != 3 || result.New != 3 {
+		t.Errorf("got %d available, %d nearby, %d new, want 3 of each", result.Available, result.Nearby, result.New)
+	}
+}
+
+func TestBatchGivesUp(t *testing.T) {
+	var requests int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	site := testSite(1, orb.Point{-74.01, 40.71})
+	c := newTestChecker(t, &memorySource{features: []*geojson.Feature{site}}, map[string]interface{}{
+		"silent":               false,
+		"notifier":             []string{notifierHTTP},
+		"notification-url":     srv.URL,
+		"notification-retries": 0,
+		"notify-batch-window":  time.Hour,
+	})
+	defer c.Flush(context.Background())
+
+	if result, err := c.Check(context.Background()); err != nil || result.Queued != 1 {
+		t.Fatalf("got %+v, %v, want the site queued", result, err)
+	}
+
+	for i := 0; i < maxBatchAttempts+1; i++ {
+		c.flush(context.Background(), true)
+	}
+	if got := atomic.LoadInt32(&requests); got != maxBatchAttempts {
+		t.Errorf("got %d requests, want %d", got, maxBatchAttempts)
+	}
+	if len(c.batch) != 0 {
+		t.Errorf("got %d sites still batched, want none", len(c.batch))
+	}
+}
+
+func TestForgetDeliveredKeepsBatched(t *testing.T) {
+	c := newTestChecker(t, &memorySource{}, nil)
+
+	site := testSite(1, orb.Point{-74.01, 40.71})
+	c.batch = []*geojson.Feature{site}
+	c.delivered[featureKey(site)] = map[string]bool{notifierHTTP: true}
+
+	// no longer found, but still waiting to go out to the rest of the notifiers
+	c.forgetDelivered(nil)
+
+	if !c.delivered[featureKey(site)][notifierHTTP] {
+		t.Error("forgot a site still waiting in the batch")
+	}
+
+	c.batch = nil
+	c.forgetDelivered(nil)
+
+	if len(c.delivered) != 0 {
+		t.Errorf("got %v, want nothing delivered kept", c.delivered)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"strconv"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	colorAuto   = "auto"
+	colorAlways = "always"
+	colorNever  = "never"
+
+	ansiReset  = "\x1b[0m"
+	ansiBold   = "\x1b[1m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+)
+
+var (
+	errInvalidColor         = errors.New("invalid --color, should be auto, always or never")
+	errInvalidCloseDistance = errors.New("invalid --close-distance, should not be negative")
+)
+
+// useColor is whether to color console output. JSON output is never colored, and auto
+// only colors when stdout is a terminal.
+func useColor() bool {
+	if jsonOutput() {
+		return false
+	}
+
+	switch viper.GetString("color") {
+	case colorAlways:
+		return true
+	case colorAuto:
+		return isTerminal(os.Stdout)
+	}
+	return false
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// colorize wraps s in the ANSI code, if we're coloring output.
+func colorize(s, code string) string {
+	if !useColor() {
+		return s
+	}
+	return code + s + ansiReset
+}
+
+// boldCount is n for the check summary, which is only bolded in text logs.
+func boldCount(n int) string {
+	s := strconv.Itoa(n)
+	if viper.GetString("log-format") != logFormatText {
+		return s
+	}
+	return colorize(s, ansiBold)
+}
+
+// closeDistance is --close-distance in meters, defaulting to half of --distance.
+func closeDistance(unit string) float64 {
+	d := viper.GetFloat64("close-distance")
+	if d <= 0 {
+		d = viper.GetFloat64("distance") / 2
+	}
+	return d * distanceUnits[unit]
+}
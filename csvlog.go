@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/spf13/viper"
+)
+
+var csvLogHeader = []string{"timestamp", "id", "provider", "address", "city", "state", "distance_km", "appointment_count", "soonest_time"}
+
+// appendCSVLog adds a row to the --csv-log file for each of found, writing the header
+// first if the file is new.
+func appendCSVLog(path string, found []*geojson.Feature, locations orb.MultiPoint, layout string, now time.Time, mappings []typeMapping) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening csv log: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("error opening csv log: %w", err)
+	}
+
+	w := csv.NewWriter(f)
+
+	if info.Size() == 0 {
+		w.Write(csvLogHeader)
+	}
+	for _, feature := range found {
+		out := newOutputFeature(feature, locations, mappings)
+
+		w.Write([]string{
+			now.Format(time.RFC3339),
+			strconv.Itoa(out.ID),
+			out.Provider,
+			out.Address,
+			out.City,
+			out.State,
+			strconv.FormatFloat(out.DistanceKM, 'f', 2, 64),
+			strconv.Itoa(appointmentCount(feature, viper.GetInt("unlisted-appointments"))),
+			soonestAppointment(feature, layout),
+		})
+	}
+	w.Flush()
+
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("error writing csv log: %w", err)
+	}
+	return f.Close()
+}
+
+// soonestAppointment is the time of f's earliest appointment, or empty if it doesn't list
+// any with a time we can parse.
+func soonestAppointment(f *geojson.Feature, layout string) string {
+	if t, ok := soonestTime(f, layout); ok {
+		return t.Format(time.RFC3339)
+	}
+	return ""
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+func TestAppendCSVLogCounts(t *testing.T) {
+	setConfig(t, nil)
+
+	counted := geojson.NewFeature(orb.Point{-74, 40.7})
+	counted.Properties["id"] = 1.0
+	counted.Properties["appointments"] = 12.0
+
+	times := geojson.NewFeature(orb.Point{-74, 40.7})
+	times.Properties["id"] = 2.0
+	times.Properties["appointments"] = []interface{}{"2021-05-01T09:00:00", "2021-05-01T09:15:00"}
+
+	path := filepath.Join(t.TempDir(), "log.csv")
+	found := []*geojson.Feature{counted, times}
+
+	if err := appendCSVLog(path, found, orb.MultiPoint{{-74, 40.7}}, time.RFC3339, time.Now(), defaultMappings); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, want a header and 2", len(rows))
+	}
+	for i, want := range []string{"12", "2"} {
+		if got := rows[i+1][7]; got != want {
+			t.Errorf("row %d: got appointment_count %s, want %s", i+1, got, want)
+		}
+	}
+}
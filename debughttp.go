@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+const debugBodyMax = 4096
+
+// secretHeaders are logged without their values at all.
+var secretHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+}
+
+// debugTransport logs each request and response going through next, under --debug-http.
+type debugTransport struct {
+	next http.RoundTripper
+	log  zerolog.Logger
+}
+
+// withDebug wraps rt to log what goes over the wire if --debug-http is set.
+func withDebug(rt http.RoundTripper, log zerolog.Logger) http.RoundTripper {
+	if !viper.GetBool("debug-http") {
+		return rt
+	}
+	return &debugTransport{next: rt, log: log}
+}
+
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+
+	switch {
+	case req.GetBody != nil:
+		rc, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		body, err = ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+
+	case req.Body != nil && req.Body != http.NoBody:
+		b, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(b))
+		body = b
+	}
+
+	t.log.Info().
+		Str("method", req.Method).
+		Str("url", redactSecrets(req.URL.Redacted())).
+		Strs("headers", debugHeaders(req.Header)).
+		Str("body", redactSecrets(debugBody(body))).
+		Msg("http request")
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		t.log.Info().Err(err).Str("url", redactSecrets(req.URL.Redacted())).Msg("http request failed")
+		return nil, err
+	}
+
+	// only as much as gets logged is read ahead, so big search responses still stream
+	head, err := ioutil.ReadAll(io.LimitReader(resp.Body, debugBodyMax+1))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), resp.Body), resp.Body}
+
+	t.log.Info().
+		Str("url", redactSecrets(req.URL.Redacted())).
+		Str("status", resp.Status).
+		Strs("headers", debugHeaders(resp.Header)).
+		Str("body", redactSecrets(debugBody(responseHead(resp, head)))).
+		Msg("http response")
+
+	return resp, nil
+}
+
+// debugHeaders lists h as "Key: value" lines, in order.
+func debugHeaders(h http.Header) []string {
+	var ret []string
+
+	for k, values := range h {
+		for _, v := range values {
+			if secretHeaders[k] {
+				v = redacted
+			}
+			ret = append(ret, k+": "+redactSecrets(v))
+		}
+	}
+	sort.Strings(ret)
+
+	return ret
+}
+
+// responseHead is the start of resp's body, head, decompressed as far as it goes if it's
+// gzipped, since the search asks for that itself.
+func responseHead(resp *http.Response, head []byte) []byte {
+	if !strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		return head
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(head))
+	if err != nil {
+		return []byte("(gzipped)")
+	}
+	// it's cut off, so this stops early with an error
+	b, _ := ioutil.ReadAll(zr)
+
+	return b
+}
+
+func debugBody(b []byte) string {
+	if len(b) > debugBodyMax {
+		return string(b[:debugBodyMax]) + "..."
+	}
+	return string(b)
+}
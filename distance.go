@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"math"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geo"
+	"github.com/spf13/viper"
+)
+
+const (
+	distanceHaversine       = "haversine"
+	distanceVincenty        = "vincenty"
+	distanceEquirectangular = "equirectangular"
+
+	// WGS-84
+	wgs84A = 6378137.0
+	wgs84F = 1 / 298.257223563
+	wgs84B = wgs84A * (1 - wgs84F)
+
+	vincentyIterations = 200
+)
+
+var errInvalidDistanceAlgorithm = errors.New("invalid --distance-algorithm, should be haversine, vincenty or equirectangular")
+
+// each --distance-algorithm, in meters
+var distanceFuncs = map[string]func(p1, p2 orb.Point) float64{
+	distanceHaversine:       geo.DistanceHaversine,
+	distanceVincenty:        vincentyDistance,
+	distanceEquirectangular: geo.Distance,
+}
+
+// pointDistance is the distance between p1 and p2 by --distance-algorithm, in meters.
+func pointDistance(p1, p2 orb.Point) float64 {
+	if f, ok := distanceFuncs[viper.GetString("distance-algorithm")]; ok {
+		return f(p1, p2)
+	}
+	return geo.DistanceHaversine(p1, p2)
+}
+
+// vincentyDistance is the distance between p1 and p2 on the WGS-84 ellipsoid, using
+// Vincenty's inverse formula. It falls back to haversine for the nearly antipodal points
+// the formula doesn't converge for.
+func vincentyDistance(p1, p2 orb.Point) float64 {
+	var (
+		l  = deg2rad(p2.Lon() - p1.Lon())
+		u1 = math.Atan((1 - wgs84F) * math.Tan(deg2rad(p1.Lat())))
+		u2 = math.Atan((1 - wgs84F) * math.Tan(deg2rad(p2.Lat())))
+
+		sinU1, cosU1 = math.Sincos(u1)
+		sinU2, cosU2 = math.Sincos(u2)
+
+		lambda = l
+	)
+
+	for i := 0; i < vincentyIterations; i++ {
+		sinLambda, cosLambda := math.Sincos(lambda)
+
+		sinSigma := math.Hypot(cosU2*sinLambda, cosU1*sinU2-sinU1*cosU2*cosLambda)
+		if sinSigma == 0 {
+			// the same point
+			return 0
+		}
+		cosSigma := sinU1*sinU2 + cosU1*cosU2*cosLambda
+		sigma := math.Atan2(sinSigma, cosSigma)
+
+		sinAlpha := cosU1 * cosU2 * sinLambda / sinSigma
+		cos2Alpha := 1 - sinAlpha*sinAlpha
+
+		var cos2SigmaM float64
+		if cos2Alpha != 0 {
+			// otherwise both points are on the equator
+			cos2SigmaM = cosSigma - 2*sinU1*sinU2/cos2Alpha
+		}
+
+		c := wgs84F / 16 * cos2Alpha * (4 + wgs84F*(4-3*cos2Alpha))
+		prev := lambda
+		lambda = l + (1-c)*wgs84F*sinAlpha*(sigma+c*sinSigma*(cos2SigmaM+c*cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)))
+
+		if math.Abs(lambda-prev) < 1e-12 {
+			uSq := cos2Alpha * (wgs84A*wgs84A - wgs84B*wgs84B) / (wgs84B * wgs84B)
+			a := 1 + uSq/16384*(4096+uSq*(-768+uSq*(320-175*uSq)))
+			b := uSq / 1024 * (256 + uSq*(-128+uSq*(74-47*uSq)))
+			deltaSigma := b * sinSigma * (cos2SigmaM + b/4*(cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)-
+				b/6*cos2SigmaM*(-3+4*sinSigma*sinSigma)*(-3+4*cos2SigmaM*cos2SigmaM)))
+
+			return wgs84B * a * (sigma - deltaSigma)
+		}
+	}
+	return geo.DistanceHaversine(p1, p2)
+}
+
+func deg2rad(d float64) float64 {
+	return d * math.Pi / 180
+}
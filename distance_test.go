@@ -0,0 +1,65 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/paulmach/orb"
+)
+
+// dms is degrees, minutes and seconds as decimal degrees.
+func dms(d, m, s float64) float64 {
+	if d < 0 {
+		return d - m/60 - s/3600
+	}
+	return d + m/60 + s/3600
+}
+
+func TestVincentyDistance(t *testing.T) {
+	tests := []struct {
+		name   string
+		p1, p2 orb.Point
+		want   float64 // meters
+		within float64
+	}{
+		{"same point", orb.Point{-74, 40.7}, orb.Point{-74, 40.7}, 0, 0},
+		// Vincenty's own example, from his 1975 paper
+		{
+			"Flinders Peak to Buninyong",
+			orb.Point{dms(144, 25, 29.52440), dms(-37, 57, 3.72030)},
+			orb.Point{dms(143, 55, 35.38390), dms(-37, 39, 10.15610)},
+			54972.271, 0.001,
+		},
+		{"a degree along the equator", orb.Point{0, 0}, orb.Point{1, 0}, 111319.491, 0.001},
+		{"a degree along a meridian", orb.Point{0, 0}, orb.Point{0, 1}, 110574.389, 0.001},
+		// doesn't converge, so it's haversine's half the circumference
+		{"nearly antipodal", orb.Point{0, 0}, orb.Point{179.9, 0.1}, math.Pi * orb.EarthRadius, 100000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := vincentyDistance(tt.p1, tt.p2); math.Abs(got-tt.want) > tt.within {
+				t.Errorf("got %.3fm, want %.3fm", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPointDistanceAlgorithms(t *testing.T) {
+	var (
+		hoboken = orb.Point{-74.0324, 40.7440}
+		newark  = orb.Point{-74.1724, 40.7357}
+		want    = vincentyDistance(hoboken, newark)
+	)
+
+	for _, algorithm := range []string{distanceHaversine, distanceVincenty, distanceEquirectangular} {
+		t.Run(algorithm, func(t *testing.T) {
+			setConfig(t, map[string]interface{}{"distance-algorithm": algorithm})
+
+			// over a few miles they all agree to within how each models the earth
+			if got := pointDistance(hoboken, newark); math.Abs(got-want) > want*0.005 {
+				t.Errorf("got %.1fm, want within 0.5%% of %.1fm", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var errInvalidEnvFile = errors.New("invalid --env-file line, should be KEY=value")
+
+// loadEnvFile sets the variables in the .env file at path that aren't already in the
+// environment. Keys without the VC_ prefix get it, and dashes become underscores, so
+// telegram-bot-token=... works as well as VC_TELEGRAM_BOT_TOKEN=...
+func loadEnvFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error reading env file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+
+	for n := 1; scanner.Scan(); n++ {
+		key, value, ok, err := parseEnvLine(scanner.Text())
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		if !ok {
+			continue
+		}
+
+		key = strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+		if !strings.HasPrefix(key, "VC_") {
+			key = "VC_" + key
+		}
+
+		if _, set := os.LookupEnv(key); set {
+			continue
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// parseEnvLine parses a line of a .env file, returning false for blank lines and comments.
+// Values can be single quoted, taken as is, or double quoted, with \n, \t, \" and \\
+// escapes. Unquoted values end at a # preceded by a space.
+func parseEnvLine(line string) (string, string, bool, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", "", false, nil
+	}
+	line = strings.TrimPrefix(line, "export ")
+
+	i := strings.Index(line, "=")
+	if i <= 0 {
+		return "", "", false, fmt.Errorf("%w: %s", errInvalidEnvFile, line)
+	}
+	key, rest := strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+
+	if rest == "" {
+		return key, "", true, nil
+	}
+
+	switch rest[0] {
+	case '\'':
+		end := strings.Index(rest[1:], "'")
+		if end < 0 {
+			return "", "", false, fmt.Errorf("%w: unterminated quote in %s", errInvalidEnvFile, key)
+		}
+		return key, rest[1 : end+1], true, nil
+
+	case '"':
+		var b strings.Builder
+
+		for j := 1; j < len(rest); j++ {
+			switch c := rest[j]; {
+			case c == '"':
+				return key, b.String(), true, nil
+			case c == '\\' && j+1 < len(rest):
+				j++
+				switch rest[j] {
+				case 'n':
+					b.WriteByte('\n')
+				case 't':
+					b.WriteByte('\t')
+				default:
+					b.WriteByte(rest[j])
+				}
+			default:
+				b.WriteByte(c)
+			}
+		}
+		return "", "", false, fmt.Errorf("%w: unterminated quote in %s", errInvalidEnvFile, key)
+	}
+
+	if j := strings.Index(rest, " #"); j >= 0 {
+		rest = strings.TrimSpace(rest[:j])
+	}
+	return key, rest, true, nil
+}
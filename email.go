@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+// emailNotifier emails found sites through an SMTP server, upgrading to TLS with
+// STARTTLS when the server supports it.
+type emailNotifier struct {
+	host      string
+	port      int
+	username  string
+	password  string
+	from      string
+	to        []string
+	timeout   time.Duration
+	locations orb.MultiPoint
+	unit      string
+}
+
+func newEmailNotifier(locations orb.MultiPoint, unit string) *emailNotifier {
+	return &emailNotifier{
+		host:      viper.GetString("smtp-host"),
+		port:      viper.GetInt("smtp-port"),
+		username:  viper.GetString("smtp-username"),
+		password:  viper.GetString("smtp-password"),
+		from:      viper.GetString("email-from"),
+		to:        viper.GetStringSlice("email-to"),
+		timeout:   viper.GetDuration("notification-timeout"),
+		locations: locations,
+		unit:      unit,
+	}
+}
+
+func (n *emailNotifier) Notify(ctx context.Context, found []*geojson.Feature) error {
+	msg, err := n.message(ctx, found)
+	if err != nil {
+		return err
+	}
+
+	if viper.GetBool("dry-run") {
+		fmt.Fprintf(textOut(), "dry run, would email %s at %s with:\n%s\n", strings.Join(n.to, ", "), time.Now().Format(time.RFC1123), msg)
+		return nil
+	}
+	zerolog.Ctx(ctx).Info().Strs("to", n.to).Msg("notifying")
+
+	if err := n.send(ctx, msg); err != nil {
+		return fmt.Errorf("error sending email: %w", err)
+	}
+	return nil
+}
+
+func (n *emailNotifier) message(ctx context.Context, found []*geojson.Feature) ([]byte, error) {
+	text, err := notificationText(ctx, found, n.locations)
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "From: %s\r\n", n.from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(n.to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", notificationTitle(ctx, len(found)))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(text, "\n", "\r\n"))
+
+	return b.Bytes(), nil
+}
+
+// send delivers msg within --notification-timeout, giving up early if ctx is done.
+func (n *emailNotifier) send(ctx context.Context, msg []byte) error {
+	if n.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, n.timeout)
+		defer cancel()
+	}
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", net.JoinHostPort(n.host, strconv.Itoa(n.port)))
+	if err != nil {
+		return err
+	}
+	// the whole conversation has to fit in ctx, not just the dial, so a server that stalls
+	// partway can't hold up the check
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	c, err := smtp.NewClient(conn, n.host)
+	if err != nil {
+		conn.Close()
+	} else {
+		defer c.Close()
+		err = n.deliver(c, msg)
+	}
+
+	if err != nil && ctx.Err() != nil {
+		// the connection was closed under it, which makes for a confusing error
+		return ctx.Err()
+	}
+	return err
+}
+
+func (n *emailNotifier) deliver(c *smtp.Client, msg []byte) error {
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: n.host}); err != nil {
+			return err
+		}
+	}
+
+	if n.username != "" {
+		if err := c.Auth(smtp.PlainAuth("", n.username, n.password, n.host)); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(n.from); err != nil {
+		return err
+	}
+	for _, to := range n.to {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
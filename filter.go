@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/vm"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/spf13/viper"
+)
+
+// compileFilter compiles --filter, returning nil if there isn't one.
+func compileFilter() (*vm.Program, error) {
+	text := viper.GetString("filter")
+	if text == "" {
+		return nil, nil
+	}
+
+	p, err := expr.Compile(text, expr.AsBool())
+	if err != nil {
+		return nil, fmt.Errorf("invalid --filter: %w", err)
+	}
+	return p, nil
+}
+
+// filterEnv is the variables --filter is evaluated with for f, at p: its properties, as the
+// upstream sent them, plus:
+//
+//	distance          from the nearest location, in --distance-unit
+//	distance_km       the same, in km
+//	appointment_count as counted for --min-appointments
+//	appointments      each with time, hours (from now, nil if the time doesn't parse), type,
+//	                  vaccine and dose, normalized as for --type-map
+//	vaccines          the normalized vaccines of the appointments
+//	soonest_hours     hours until the soonest appointment, nil if none has a time
+func filterEnv(f *geojson.Feature, p orb.Point, locations orb.MultiPoint, unit string, now time.Time, mappings []typeMapping) map[string]interface{} {
+	env := make(map[string]interface{}, len(f.Properties)+7)
+
+	for k, v := range f.Properties {
+		env[k] = v
+	}
+
+	d := nearestDistance(p, locations)
+	env["distance"] = d / distanceUnits[unit]
+	env["distance_km"] = d / metersPerKilometer
+	env["appointment_count"] = appointmentCount(f, viper.GetInt("unlisted-appointments"))
+
+	var (
+		appts    = []interface{}{}
+		vaccines = []interface{}{}
+		seen     = map[string]bool{}
+		soonest  interface{}
+	)
+
+	for _, fields := range featureAppointments(f) {
+		typ, _ := mapString(fields, "type", "").(string)
+		t := normalizeType(typ, mappings)
+
+		a := map[string]interface{}{
+			"time":    mapString(fields, "time", nil),
+			"hours":   nil,
+			"type":    typ,
+			"vaccine": t.Vaccine,
+			"dose":    t.Dose,
+		}
+		if at, ok := appointmentTime(fields, viper.GetString("time-layout")); ok {
+			hours := at.Sub(now).Hours()
+			a["hours"] = hours
+
+			if s, ok := soonest.(float64); !ok || hours < s {
+				soonest = hours
+			}
+		}
+		appts = append(appts, a)
+
+		if !seen[t.Vaccine] {
+			seen[t.Vaccine] = true
+			vaccines = append(vaccines, t.Vaccine)
+		}
+	}
+	env["appointments"] = appts
+	env["vaccines"] = vaccines
+	env["soonest_hours"] = soonest
+
+	return env
+}
+
+// matchesFilter evaluates --filter against f, at p. Sites the filter can't be evaluated
+// for, say from comparing a missing property, don't match.
+func (c *Checker) matchesFilter(f *geojson.Feature, p orb.Point) bool {
+	if c.filter == nil {
+		return true
+	}
+
+	out, err := expr.Run(c.filter, filterEnv(f, p, c.Locations, c.Unit, time.Now(), c.typeMap))
+	if err != nil {
+		c.log.Warn().Err(err).Int("id", featureID(f)).Msg("error evaluating --filter, skipping site")
+		return false
+	}
+	ok, _ := out.(bool)
+
+	return ok
+}
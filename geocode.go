@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/paulmach/orb"
+)
+
+const (
+	geocoderNominatim = "nominatim"
+
+	nominatimURL        = "https://nominatim.openstreetmap.org/search"
+	nominatimReverseURL = "https://nominatim.openstreetmap.org/reverse"
+)
+
+var (
+	errUnknownGeocoder  = errors.New("unknown geocoder")
+	errNoGeocodeResults = errors.New("no geocoding results for address")
+	errGeocodeFailed    = errors.New("geocoding failed")
+	errNoStateFound     = errors.New("no US state found for location")
+)
+
+// geocoder resolves a street address to coordinates, and coordinates back to the US state
+// they're in.
+type geocoder interface {
+	geocode(ctx context.Context, address string) (orb.Point, error)
+	state(ctx context.Context, p orb.Point) (string, error)
+}
+
+var geocoders = map[string]func(client *http.Client) geocoder{
+	geocoderNominatim: func(client *http.Client) geocoder {
+		return &nominatimGeocoder{client: client, url: nominatimURL, reverseURL: nominatimReverseURL}
+	},
+}
+
+func newGeocoder(name string) (geocoder, error) {
+	ctor, ok := geocoders[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errUnknownGeocoder, name)
+	}
+	return ctor(&http.Client{Timeout: 30 * time.Second, Transport: newTransport("")}), nil
+}
+
+// nominatimGeocoder uses OpenStreetMap's Nominatim search API.
+type nominatimGeocoder struct {
+	client     *http.Client
+	url        string
+	reverseURL string
+}
+
+func (g *nominatimGeocoder) geocode(ctx context.Context, address string) (orb.Point, error) {
+	q := url.Values{
+		"q":      {address},
+		"format": {"json"},
+		"limit":  {"1"},
+	}
+
+	var results []struct {
+		Lat string `json:"lat"`
+		Lon string `json:"lon"`
+	}
+
+	if err := g.get(ctx, g.url+"?"+q.Encode(), &results); err != nil {
+		return orb.Point{}, err
+	}
+	if len(results) == 0 {
+		return orb.Point{}, fmt.Errorf("%w: %q", errNoGeocodeResults, address)
+	}
+
+	lat, err := strconv.ParseFloat(results[0].Lat, 64)
+	if err != nil {
+		return orb.Point{}, fmt.Errorf("%w: invalid latitude %q", errGeocodeFailed, results[0].Lat)
+	}
+	lon, err := strconv.ParseFloat(results[0].Lon, 64)
+	if err != nil {
+		return orb.Point{}, fmt.Errorf("%w: invalid longitude %q", errGeocodeFailed, results[0].Lon)
+	}
+	return orb.Point{lon, lat}, nil
+}
+
+func (g *nominatimGeocoder) state(ctx context.Context, p orb.Point) (string, error) {
+	q := url.Values{
+		"lat":            {strconv.FormatFloat(p.Lat(), 'f', -1, 64)},
+		"lon":            {strconv.FormatFloat(p.Lon(), 'f', -1, 64)},
+		"format":         {"json"},
+		"zoom":           {"5"}, // state level
+		"addressdetails": {"1"},
+	}
+
+	var result struct {
+		Address struct {
+			// e.g. US-NJ
+			ISO3166 string `json:"ISO3166-2-lvl4"`
+		} `json:"address"`
+	}
+
+	if err := g.get(ctx, g.reverseURL+"?"+q.Encode(), &result); err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(result.Address.ISO3166, "US-") {
+		return "", fmt.Errorf("%w: %v,%v", errNoStateFound, p.Lat(), p.Lon())
+	}
+	return strings.TrimPrefix(result.Address.ISO3166, "US-"), nil
+}
+
+// get fetches u and decodes the JSON response into v.
+func (g *nominatimGeocoder) get(ctx context.Context, u string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	// required by the Nominatim usage policy
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errGeocodeFailed, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s", errGeocodeFailed, resp.Status)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("%w: %v", errGeocodeFailed, err)
+	}
+	return nil
+}
+
+// geocodeCache remembers resolved addresses on disk, so restarts don't need to geocode again.
+type geocodeCache struct {
+	path    string
+	entries map[string]orb.Point
+}
+
+func loadGeocodeCache(path string) *geocodeCache {
+	c := &geocodeCache{path: path, entries: map[string]orb.Point{}}
+
+	if b, err := ioutil.ReadFile(path); err == nil {
+		// a corrupt cache is no worse than an empty one
+		_ = json.Unmarshal(b, &c.entries)
+	}
+	return c
+}
+
+func (c *geocodeCache) get(geocoder, address string) (orb.Point, bool) {
+	p, ok := c.entries[geocoder+"|"+address]
+	return p, ok
+}
+
+func (c *geocodeCache) put(geocoder, address string, p orb.Point) error {
+	c.entries[geocoder+"|"+address] = p
+
+	b, err := json.MarshalIndent(c.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(c.path, b, 0o644)
+}
+
+func defaultGeocodeCachePath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "vaccine-checker", "geocode.json")
+}
+
+// geocodeAddress resolves address with the named geocoder, consulting the cache at
+// cachePath first if there is one.
+func geocodeAddress(ctx context.Context, name, address, cachePath string) (orb.Point, bool, error) {
+	var cache *geocodeCache
+
+	if cachePath != "" {
+		cache = loadGeocodeCache(cachePath)
+
+		if p, ok := cache.get(name, address); ok {
+			return p, true, nil
+		}
+	}
+
+	g, err := newGeocoder(name)
+	if err != nil {
+		return orb.Point{}, false, err
+	}
+
+	p, err := g.geocode(ctx, address)
+	if err != nil {
+		return orb.Point{}, false, err
+	}
+
+	if cache != nil {
+		if err := cache.put(name, address, p); err != nil {
+			return p, false, fmt.Errorf("error writing geocode cache: %w", err)
+		}
+	}
+	return p, false, nil
+}
+
+// locationStates looks up the US state each of locations is in with the named geocoder,
+// listing each state once.
+func locationStates(ctx context.Context, name string, locations orb.MultiPoint) ([]string, error) {
+	g, err := newGeocoder(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		ret  []string
+		seen = map[string]bool{}
+	)
+
+	for _, p := range locations {
+		state, err := g.state(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[state] {
+			seen[state] = true
+			ret = append(ret, state)
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const defaultGeolocateURL = "https://ipapi.co/json/"
+
+var (
+	errGeolocateFailed = errors.New("geolocation failed")
+)
+
+// geolocation is roughly where our IP address is, as returned by the --geolocate-url.
+type geolocation struct {
+	City      string  `json:"city"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// useGeolocate reports whether to look up our location from our IP address, which is only
+// done when there's nothing else to go on.
+func useGeolocate() bool {
+	return viper.GetBool("geolocate") && viper.GetString("address") == "" && !viper.IsSet("latitude") && !viper.IsSet("longitude")
+}
+
+func geolocate(ctx context.Context, target string) (*geolocation, error) {
+	client := &http.Client{Timeout: 10 * time.Second, Transport: newTransport("")}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errGeolocateFailed, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s", errGeolocateFailed, resp.Status)
+	}
+
+	var ret geolocation
+
+	if err := json.NewDecoder(resp.Body).Decode(&ret); err != nil {
+		return nil, fmt.Errorf("%w: %v", errGeolocateFailed, err)
+	}
+	if ret.Latitude == 0 && ret.Longitude == 0 {
+		return nil, fmt.Errorf("%w: no coordinates returned", errGeolocateFailed)
+	}
+	return &ret, nil
+}
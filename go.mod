@@ -3,8 +3,18 @@ module github.com/carldunham/vaccine-checker
 go 1.16
 
 require (
+	github.com/antonmedv/expr v1.9.0
+	github.com/fsnotify/fsnotify v1.4.7
 	github.com/hashicorp/go-multierror v1.1.1
+	github.com/mattn/go-sqlite3 v1.14.7
 	github.com/paulmach/orb v0.2.1
+	github.com/prometheus/client_golang v1.11.0
+	github.com/rs/zerolog v1.21.0
 	github.com/spf13/pflag v1.0.5
 	github.com/spf13/viper v1.7.1
+	go.opentelemetry.io/otel v1.3.0
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.3.0
+	go.opentelemetry.io/otel/sdk v1.3.0
+	go.opentelemetry.io/otel/trace v1.3.0
+	golang.org/x/time v0.0.0-20210220033141-f8bda1e9f3ba
 )
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const minutesPerDay = 24 * 60
+
+var (
+	errInvalidClock       = errors.New("invalid time of day, should be HH:MM")
+	errPartialActiveHours = errors.New("--active-hours-start and --active-hours-end must be given together")
+)
+
+// activeHours is a daily window, in minutes since midnight, during which we check. A
+// window whose end is before its start wraps past midnight.
+type activeHours struct {
+	start, end int
+	loc        *time.Location
+	always     bool
+}
+
+func parseActiveHours(start, end, timezone string) (*activeHours, error) {
+	loc, err := loadLocation(timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	if start == "" && end == "" {
+		return &activeHours{loc: loc, always: true}, nil
+	}
+	if start == "" || end == "" {
+		return nil, errPartialActiveHours
+	}
+
+	ret := &activeHours{loc: loc}
+
+	if ret.start, err = parseClock(start); err != nil {
+		return nil, err
+	}
+	if ret.end, err = parseClock(end); err != nil {
+		return nil, err
+	}
+	ret.always = ret.start == ret.end
+
+	return ret, nil
+}
+
+func (a *activeHours) contains(t time.Time) bool {
+	if a.always {
+		return true
+	}
+	t = t.In(a.loc)
+	m := t.Hour()*60 + t.Minute()
+
+	if a.start < a.end {
+		return m >= a.start && m < a.end
+	}
+	// wraps midnight
+	return m >= a.start || m < a.end
+}
+
+// parseClock parses HH:MM into minutes since midnight.
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", errInvalidClock, s)
+	}
+	return (t.Hour()*60 + t.Minute()) % minutesPerDay, nil
+}
+
+// loadLocation is time.LoadLocation, except that an empty name means local time rather
+// than UTC.
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(name)
+}
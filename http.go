@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+// eventHeader says whether a notification is about found or cleared sites.
+const eventHeader = "X-Vaccine-Checker-Event"
+
+// HTTPNotifier hits --notification-url with the notification params, or the rendered
+// --notification-body-template.
+type HTTPNotifier struct {
+	client       *http.Client
+	url          string
+	method       string
+	params       []string
+	contentType  string
+	headers      []string
+	bodyTemplate string
+	locations    orb.MultiPoint
+}
+
+func NewHTTPNotifier(client *http.Client, locations orb.MultiPoint) *HTTPNotifier {
+	return &HTTPNotifier{
+		client:       client,
+		url:          viper.GetString("notification-url"),
+		method:       viper.GetString("notification-method"),
+		params:       viper.GetStringSlice("notification-params"),
+		contentType:  viper.GetString("notification-content-type"),
+		headers:      viper.GetStringSlice("notification-headers"),
+		bodyTemplate: viper.GetString("notification-body-template"),
+		locations:    locations,
+	}
+}
+
+func (n *HTTPNotifier) Notify(ctx context.Context, found []*geojson.Feature) error {
+	var (
+		req     *http.Request
+		data    = newNotificationData(ctx, found, n.locations)
+		headers = append([]string{eventHeader + ":" + eventFrom(ctx)}, n.headers...)
+	)
+
+	// targetURL and buildBody do their own encoding
+	params, err := renderParams(n.params, data)
+	if err != nil {
+		return err
+	}
+
+	if n.bodyTemplate != "" {
+		var b []byte
+
+		if b, err = renderTemplate("notification-body-template", n.bodyTemplate, data); err != nil {
+			return err
+		}
+		req, err = newRequestWithBody(ctx, n.method, n.targetURL(params), bytes.NewReader(b), n.contentType, headers)
+	} else {
+		req, err = newRequest(ctx, n.method, n.targetURL(params), params, n.contentType, headers)
+	}
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+
+	b, err := sendNotification(ctx, n.client, req)
+	if err != nil {
+		return err
+	}
+	if b != nil {
+		zerolog.Ctx(ctx).Debug().Msg(string(b))
+	}
+	return nil
+}
+
+// targetURL is the URL to notify, with params as the query unless they're going in the body.
+func (n *HTTPNotifier) targetURL(params []string) string {
+	// params go in the body, unless it's coming from the template
+	if paramsInBody(n.method) && n.bodyTemplate == "" {
+		return n.url
+	}
+
+	if len(params) > 0 {
+		return n.url + "?" + encodeQuery(params)
+	}
+	return n.url
+}
+
+// encodeQuery joins params into a query string, escaping each key and value so that
+// spaces, & and the like in them don't break the URL.
+func encodeQuery(params []string) string {
+	parts := make([]string, 0, len(params))
+
+	for _, p := range params {
+		k, v, err := splitParam(p)
+		if err != nil {
+			// no value, e.g. a bare flag
+			parts = append(parts, url.QueryEscape(p))
+			continue
+		}
+		parts = append(parts, url.QueryEscape(k)+"="+url.QueryEscape(v))
+	}
+	return strings.Join(parts, "&")
+}
+
+// renderParams renders any templates in the values of params, like count={{.NewCount}},
+// against data. Params without a template are left as they are.
+func renderParams(params []string, data notificationData) ([]string, error) {
+	var ret []string
+
+	for _, p := range params {
+		if !strings.Contains(p, "{{") {
+			ret = append(ret, p)
+			continue
+		}
+
+		k, v, err := splitParam(p)
+		if err != nil {
+			return nil, err
+		}
+		b, err := renderTemplate("notification-params", v, data)
+		if err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, k+"="+string(b))
+	}
+	return ret, nil
+}
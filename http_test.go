@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// slowServer takes longer to answer than any test waits for, unless the request is given
+// up on first.
+func slowServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestHTTPNotifierTimeout(t *testing.T) {
+	srv := slowServer(t)
+	c := newTestChecker(t, &memorySource{}, map[string]interface{}{
+		"silent":               false,
+		"notifier":             []string{notifierHTTP},
+		"notification-url":     srv.URL,
+		"notification-timeout": 100 * time.Millisecond,
+		"notification-retries": 0,
+	})
+
+	start := time.Now()
+	err := c.TestNotify(context.Background())[notifierHTTP]
+
+	if err == nil {
+		t.Fatal("got no error from a notification that timed out")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("took %s, want about the 100ms timeout", elapsed)
+	}
+}
+
+func TestHTTPNotifierCancel(t *testing.T) {
+	srv := slowServer(t)
+	c := newTestChecker(t, &memorySource{}, map[string]interface{}{
+		"silent":               false,
+		"notifier":             []string{notifierHTTP},
+		"notification-url":     srv.URL,
+		"notification-timeout": time.Minute,
+		"notification-retries": 3,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	err := c.TestNotify(ctx)[notifierHTTP]
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want %v", err, context.Canceled)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("took %s to give up after being cancelled", elapsed)
+	}
+}
+
+func TestSearchCancel(t *testing.T) {
+	srv := slowServer(t)
+	c := newTestChecker(t, nil, map[string]interface{}{
+		"search-url-pattern": []string{srv.URL + "/%s.json"},
+		"states":             []string{"NJ"},
+		"search-timeout":     time.Minute,
+		"search-retries":     3,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := c.Check(ctx)
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want %v", err, context.Canceled)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("took %s to give up after being cancelled", elapsed)
+	}
+}
+
+func TestEncodeQuery(t *testing.T) {
+	params := []string{"message=found 2 sites & more", "to=+15551234567", "q=a=b", "flag"}
+
+	got, err := url.ParseQuery(encodeQuery(params))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := url.Values{
+		"message": {"found 2 sites & more"},
+		"to":      {"+15551234567"},
+		"q":       {"a=b"},
+		"flag":    {""},
+	}
+	if got.Encode() != want.Encode() {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+var (
+	errInvalidLogLevel  = errors.New("invalid --log-level, should be debug, info, warn or error")
+	errInvalidLogFormat = errors.New("invalid --log-format, should be text or json")
+)
+
+func newLogger(w io.Writer, level, format string) (zerolog.Logger, error) {
+	lvl, err := parseLogLevel(level)
+	if err != nil {
+		return zerolog.Nop(), err
+	}
+
+	switch format {
+	case logFormatText:
+		w = zerolog.ConsoleWriter{Out: w, NoColor: !useColor(), TimeFormat: time.RFC1123}
+	case logFormatJSON:
+	default:
+		return zerolog.Nop(), fmt.Errorf("%w: %s", errInvalidLogFormat, format)
+	}
+	return zerolog.New(w).Level(lvl).With().Timestamp().Logger(), nil
+}
+
+func parseLogLevel(level string) (zerolog.Level, error) {
+	switch level {
+	case "debug":
+		return zerolog.DebugLevel, nil
+	case "info":
+		return zerolog.InfoLevel, nil
+	case "warn":
+		return zerolog.WarnLevel, nil
+	case "error":
+		return zerolog.ErrorLevel, nil
+	}
+	return zerolog.NoLevel, fmt.Errorf("%w: %s", errInvalidLogLevel, level)
+}
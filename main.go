@@ -4,110 +4,895 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math/rand"
+	"net/http"
 	"os"
 	"os/signal"
+	"sort"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/hashicorp/go-multierror"
 	"github.com/paulmach/orb"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
+// exit codes for --once
+const (
+	exitCodeOK    = 0
+	exitCodeError = 1
+	exitCodeFound = 2
+)
+
 const (
 	metersPerKilometer = 1000.0
+	metersPerMile      = 1609.344
 
-	defaultsearchURLPattern   = "https://www.vaccinespotter.org/api/v0/states/%s.json"
-	defaultSearchMethod       = "GET"
-	defaultNotificationURL    = "https://api.virtualbuttons.com/v1"
-	defaultNotificationMethod = "GET"
-	defaultCheckInterval      = 30 * time.Second
-	defaultDistanceKilometers = 10
+	defaultsearchURLPattern       = "https://www.vaccinespotter.org/api/v0/states/%s.json"
+	defaultSearchMethod           = "GET"
+	defaultMaxConcurrency         = 4
+	defaultSearchTimeout          = 30 * time.Second
+	defaultSearchRetries          = 3
+	defaultSearchRetryBaseDelay   = time.Second
+	defaultNotificationURL        = "https://api.virtualbuttons.com/v1"
+	defaultNotificationMethod     = "GET"
+	defaultNotificationTimeout    = 10 * time.Second
+	defaultNotificationRetries    = 2
+	defaultNotificationRetryDelay = 2 * time.Second
+	defaultSMTPPort               = 587
+	defaultCheckInterval          = 30 * time.Second
+	defaultDistance               = 10
+	defaultDistanceUnit           = "km"
+	defaultHealthStaleness        = 10 * time.Minute
+	defaultShutdownGrace          = 10 * time.Second
+	defaultTrendChecks            = 5
+	defaultMaxPages               = 10
+	defaultStateTTL               = 24 * time.Hour
 )
 
 var (
-	errInvalidLocation        = errors.New("missing or invalid location, should be latitude,longitude")
-	errMissingNotificationURL = errors.New("missing --notification-url")
-	errMissingLatitude        = errors.New("missing --latitude")
-	errMissingLongitude       = errors.New("missing --longitude")
+	errInvalidLocation         = errors.New("missing or invalid location, should be latitude,longitude")
+	errMissingNotificationURL  = errors.New("missing --notification-url")
+	errMissingSlackWebhookURL  = errors.New("missing --slack-webhook-url")
+	errMissingTelegramBotToken = errors.New("missing --telegram-bot-token")
+	errMissingTelegramChatID   = errors.New("missing --telegram-chat-id")
+	errMissingSMTPHost         = errors.New("missing --smtp-host")
+	errMissingEmailFrom        = errors.New("missing --email-from")
+	errMissingEmailTo          = errors.New("missing --email-to")
+	errMissingPushoverToken    = errors.New("missing --pushover-token")
+	errMissingPushoverUser     = errors.New("missing --pushover-user")
+	errMissingNtfyTopic        = errors.New("missing --ntfy-topic")
+	errMissingTwilioAccountSID = errors.New("missing --twilio-account-sid")
+	errMissingTwilioAuthToken  = errors.New("missing --twilio-auth-token")
+	errMissingTwilioFrom       = errors.New("missing --twilio-from")
+	errMissingTwilioTo         = errors.New("missing --twilio-to")
+	errMissingLatitude         = errors.New("missing --latitude")
+	errMissingLongitude        = errors.New("missing --longitude")
+	errMismatchedLocations     = errors.New("--latitude and --longitude should be given the same number of times")
+	errInvalidLatitude         = errors.New("invalid --latitude, should be from -90 to 90")
+	errInvalidLongitude        = errors.New("invalid --longitude, should be from -180 to 180")
+	errInvalidDistanceUnit     = errors.New("invalid --distance-unit, should be km or mi")
+	errInvalidDisplayTimezone  = errors.New("invalid --display-timezone")
+	errInvalidMinDistance      = errors.New("invalid --min-distance, should be from 0 to --distance")
+	errInvalidJitter           = errors.New("invalid --check-interval-jitter, should be from 0 to --check-interval")
+	errInvalidShutdownGrace    = errors.New("invalid --shutdown-grace, should not be negative")
+	errInvalidNotifyInterval   = errors.New("invalid --notify-min-interval, should not be negative")
+	errInvalidSuccessCodes     = errors.New("invalid --notification-success-codes, should be status codes like 201, ranges like 200-204 or classes like 2xx")
+	errMissingStateFile        = errors.New("missing --state-file, needed by --notify-once-per-site and --reset-notified")
+	errConflictingPagination   = errors.New("--next-field and --page-param can't both be given")
+	errInvalidAppointmentAge   = errors.New("invalid --max-appointment-age, should not be negative")
+	errInvalidTrendChecks      = errors.New("invalid --trend-checks, should not be negative")
 )
 
 func main() {
-	pflag.String("search-url-pattern", defaultsearchURLPattern, "Sprintf pattern for URL to search for appointments")
-	pflag.String("search-method", defaultSearchMethod, "HTTP method to hit search-url with")
-	pflag.StringSlice("search-params", nil, "query params (or body params for POST) to send with search")
-	pflag.Float64("latitude", 0, "latitude of location to check around")
-	pflag.Float64("longitude", 0, "longitude of location to check around")
-	pflag.Int32("distance", defaultDistanceKilometers, "kilometers from location to check")
-	pflag.Bool("include-second-dose-only", false, "If given, include sites that are only giving second doses")
-	pflag.String("notification-url", defaultNotificationURL, "URL to hit when appointments are found")
-	pflag.String("notification-method", defaultNotificationMethod, "HTTP method to hit notification-url with")
-	pflag.StringSlice("notification-params", nil, "query params (or body params for POST) to send with notification")
-	pflag.Duration("check-interval", defaultCheckInterval, "how often to check")
-	pflag.Bool("silent", false, "skip notification")
+	defineFlags()
 
 	pflag.Parse()
+	rand.Seed(time.Now().UnixNano())
+
 	viper.BindPFlags(pflag.CommandLine)
 
 	viper.SetEnvPrefix("VC")
 	viper.AutomaticEnv()
 	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
 
-	viper.SetConfigName("config")
-	viper.AddConfigPath(".")
-	if err := viper.ReadInConfig(); err != nil {
-		if !errors.As(err, &viper.ConfigFileNotFoundError{}) {
-			panic(fmt.Errorf("Fatal error config file: %s \n", err))
+	// AutomaticEnv looks variables up as they're read, so loading them now is soon enough
+	if path := viper.GetString("env-file"); path != "" {
+		if err := loadEnvFile(path); err != nil {
+			panic(fmt.Sprintf("invalid params: %v", err))
+		}
+	}
+
+	if path := viper.GetString("config"); path != "" {
+		// the format comes from the extension, .yaml, .json or .toml
+		viper.SetConfigFile(path)
+		if err := viper.ReadInConfig(); err != nil {
+			panic(fmt.Errorf("Fatal error config file %s: %s \n", path, err))
+		}
+	} else {
+		viper.SetConfigName("config")
+		viper.AddConfigPath(".")
+		if err := viper.ReadInConfig(); err != nil {
+			if !errors.As(err, &viper.ConfigFileNotFoundError{}) {
+				panic(fmt.Errorf("Fatal error config file: %s \n", err))
+			}
+			// else ignore file not found
+		}
+	}
+
+	// done before validating, so a failure just leaves the coordinates missing
+	var (
+		geo    *geolocation
+		geoErr error
+	)
+
+	if useGeolocate() {
+		if geo, geoErr = geolocate(context.Background(), viper.GetString("geolocate-url")); geoErr == nil {
+			viper.Set("latitude", geo.Latitude)
+			viper.Set("longitude", geo.Longitude)
 		}
-		// else ignore file not found
+	}
+
+	registerSecrets()
+
+	// built before validating, so there's a logger to say why geolocating failed
+	log, err := newLogger(textOut(), viper.GetString("log-level"), viper.GetString("log-format"))
+	if err != nil {
+		panic(fmt.Sprintf("invalid params: %v", err))
+	}
+
+	if geoErr != nil {
+		log.Error().Err(geoErr).Msg("error geolocating")
 	}
 
 	if err := validateParams(); err != nil {
+		panic(fmt.Sprintf("invalid params: %s", redactSecrets(err.Error())))
+	}
+	unit := viper.GetString("distance-unit")
+	distance := viper.GetFloat64("distance") * distanceUnits[unit]
+
+	locations := homeLocations()
+
+	if useAddress() {
+		var (
+			address  = viper.GetString("address")
+			location orb.Point
+			cached   bool
+		)
+
+		location, cached, err = geocodeAddress(context.Background(), viper.GetString("geocoder"), address, viper.GetString("geocode-cache"))
+		if err != nil {
+			panic(fmt.Sprintf("error looking up --address: %v", err))
+		}
+		locations = orb.MultiPoint{location}
+
+		log.Info().
+			Float64("latitude", location.Lat()).
+			Float64("longitude", location.Lon()).
+			Bool("cached", cached).
+			Msgf("found %s", address)
+	}
+	if geo != nil {
+		log.Info().
+			Float64("latitude", locations[0].Lat()).
+			Float64("longitude", locations[0].Lon()).
+			Msgf("geolocated to around %s", geo.City)
+	}
+
+	lookupStates := needsState()
+
+	if lookupStates {
+		states, err := locationStates(context.Background(), viper.GetString("geocoder"), locations)
+		if err != nil {
+			panic(fmt.Sprintf("error looking up the state to search, give --states instead: %v", err))
+		}
+		viper.Set("states", states)
+
+		log.Info().Strs("states", states).Msgf("searching %s", strings.Join(states, ", "))
+	}
+
+	hours, err := parseActiveHours(viper.GetString("active-hours-start"), viper.GetString("active-hours-end"), viper.GetString("timezone"))
+	if err != nil {
 		panic(fmt.Sprintf("invalid params: %v", err))
 	}
-	location := orb.Point{viper.GetFloat64("longitude"), viper.GetFloat64("latitude")}
-	distance := viper.GetFloat64("distance") * metersPerKilometer
+
+	checker, err := NewChecker(newSearchSource(log), locations, distance, unit, log)
+	if err != nil {
+		panic(fmt.Sprintf("error creating checker: %v", err))
+	}
+
+	if viper.GetBool("watch-file") {
+		if viper.ConfigFileUsed() == "" {
+			log.Warn().Msg("no config file to watch")
+		} else if err := watchConfig(checker, lookupStates, log); err != nil {
+			log.Error().Err(err).Msg("not reloading the config file when it changes")
+		}
+	}
+
+	shutdownTracing, err := setupTracing(context.Background(), viper.GetString("otel-endpoint"))
+	if err != nil {
+		panic(fmt.Sprintf("error setting up tracing: %v", err))
+	}
+	flush := func() {
+		checker.Flush(context.Background())
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+		defer cancel()
+
+		if err := shutdownTracing(shutdownCtx); err != nil {
+			log.Error().Err(err).Msg("error flushing traces")
+		}
+	}
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill)
 
-	if err := check(ctx, location, distance); err != nil {
-		fmt.Fprintf(os.Stderr, "error checking sites, moving on: %v\n", err)
+	var servers []<-chan struct{}
+
+	if addr := viper.GetString("metrics-addr"); addr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.Handler())
+
+		servers = append(servers, startServer(ctx, "metrics", addr, mux, log))
+	}
+
+	if addr := viper.GetString("health-addr"); addr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/healthz", healthHandler(checker, viper.GetDuration("health-staleness")))
+
+		servers = append(servers, startServer(ctx, "health", addr, mux, log))
+	}
+
+	if addr := viper.GetString("pprof-addr"); addr != "" {
+		servers = append(servers, startServer(ctx, "pprof", addr, pprofHandler(), log))
+	}
+
+	// checks get their own context, so that when interrupted one in progress can finish,
+	// rather than being cut off halfway through printing or notifying
+	checkCtx, cancelCheck := context.WithCancel(context.Background())
+	defer cancelCheck()
+
+	var (
+		checking int32
+		// read now, as there's no waiting for a check to finish to read it then
+		grace = viper.GetDuration("shutdown-grace")
+	)
+
+	go func() {
+		<-ctx.Done()
+		// a second interrupt kills us outright
+		stop()
+
+		if grace > 0 && atomic.LoadInt32(&checking) == 1 {
+			log.Info().Dur("grace", grace).Msgf("waiting up to %v for the check in progress to finish", grace)
+		}
+		time.AfterFunc(grace, cancelCheck)
+	}()
+
+	if addr := viper.GetString("trigger-addr"); addr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/check", triggerHandler(checkCtx, checker, log))
+
+		servers = append(servers, startServer(ctx, "trigger", addr, mux, log))
+	}
+
+	check := func() (*CheckResult, error) {
+		if !hours.contains(time.Now()) {
+			log.Info().Msg("outside active hours, skipping check")
+			return &CheckResult{}, nil
+		}
+		atomic.StoreInt32(&checking, 1)
+		defer atomic.StoreInt32(&checking, 0)
+
+		return checker.Check(checkCtx)
+	}
+
+	if viper.GetBool("test-notification") {
+		var (
+			code    = exitCodeOK
+			results = checker.TestNotify(ctx)
+			names   = make([]string, 0, len(results))
+		)
+
+		for name := range results {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			err := results[name]
+			if err != nil {
+				log.Error().Err(err).Str("notifier", name).Msgf("test notification through %s failed", name)
+				code = exitCodeError
+			} else {
+				log.Info().Str("notifier", name).Msgf("test notification sent through %s", name)
+			}
+		}
+		stop()
+		flush()
+		exitFunc(code)
+	}
+
+	if viper.GetBool("once") {
+		result, err := check()
+		stop()
+		flush()
+
+		if err != nil {
+			log.Error().Err(err).Msg("error checking sites")
+		}
+		exitFunc(onceExitCode(result, err))
+	}
+
+	terminate := func() {
+		stop()
+		flush()
+
+		for _, done := range servers {
+			<-done
+		}
+
+		checks, sites, notifications, uptime := checker.Stats()
+		log.Info().
+			Int("checks", checks).
+			Int("sites", sites).
+			Int("notifications", notifications).
+			Dur("uptime", uptime).
+			Msgf("checked %d times in %v, finding %d distinct sites and sending %d notifications", checks, uptime.Round(time.Second), sites, notifications)
+		log.Info().Msg("done.")
+		exitFunc(0)
+	}
+
+	checkAndLog := func() error {
+		result, err := check()
+		if err != nil {
+			log.Error().Err(err).Msg("error checking sites, moving on")
+		}
+
+		var exitOnFound bool
+		checker.withSettings(func() { exitOnFound = viper.GetBool("exit-on-found") })
+
+		// anything held for a batch goes out as we exit
+		if exitOnFound && notifiedNew(result) {
+			log.Info().Int("notified", result.Notified).Int("queued", result.Queued).Msg("found new sites, exiting")
+			terminate()
+		}
+		return err
 	}
 
+	err = checkAndLog()
+
 	for {
+		var wait time.Duration
+		checker.withSettings(func() { wait = nextCheck(err, log) })
+
 		select {
 		case <-ctx.Done():
-			fmt.Println("\nterminating...")
-			stop()
-			fmt.Println("done.")
-			exitFunc(0)
-		case <-time.After(viper.GetDuration("check-interval")):
-			if err := check(ctx, location, distance); err != nil {
-				fmt.Fprintf(os.Stderr, "error checking sites, moving on: %v", err)
-			}
+			log.Info().Msg("terminating...")
+			terminate()
+		case <-time.After(wait):
+			err = checkAndLog()
 		}
 	}
 }
 
+// defineFlags defines the flags on pflag.CommandLine, for main to parse.
+func defineFlags() {
+	pflag.StringArray("search-url-pattern", []string{defaultsearchURLPattern}, "Sprintf pattern for URL to search for appointments, can be given more than once, file:// reads saved responses")
+	pflag.String("search-method", defaultSearchMethod, "HTTP method to hit search-url with")
+	pflag.StringArray("search-params", nil, "comma-separated query params (or body params for POST) to send with search; with several --search-url-pattern, each gets the --search-params in the same position")
+	pflag.Bool("url-encode-params", false, "URL-encode each of the search params (and the state) before putting it into the search url pattern")
+	pflag.String("search-file", "", "read sites from this saved response, in the shape of the first --search-source, instead of searching")
+	pflag.StringSlice("search-source", []string{"vaccinespotter"}, "response shapes to search for, vaccinespotter or sites, each optionally with its own url pattern, e.g. sites=https://pharmacy.example/%s.json")
+	pflag.StringSlice("states", nil, "states to search, each in its own search, added as the last param of any pattern with a verb left for it (default the state of each location, looked up with --geocoder), also given as --state")
+	pflag.String("next-field", "", "top-level field of a search response holding the link to the next page of results, for sources that paginate")
+	pflag.String("page-param", "", "query param to number the pages of search results with, from 1 until a page comes back empty, for sources that paginate")
+	pflag.Int("max-pages", defaultMaxPages, "most pages of results to read from each search, with --next-field or --page-param")
+	pflag.Int("max-requests-per-minute", 0, "most searches to send each minute, including retries (0 = no limit)")
+	pflag.Int("max-concurrency", defaultMaxConcurrency, "how many searches to run at once when searching multiple states")
+	pflag.String("search-content-type", contentTypeForm, "content type of the search body for POST, "+contentTypeForm+" or "+contentTypeJSON)
+	pflag.StringSlice("search-headers", nil, "key:value headers to send with search, repeat a key for multiple values")
+	pflag.Duration("search-timeout", defaultSearchTimeout, "how long to wait for a search response")
+	pflag.Int("search-retries", defaultSearchRetries, "how many times to retry a failed search before giving up until the next check")
+	pflag.Duration("search-retry-base-delay", defaultSearchRetryBaseDelay, "delay before the first search retry, doubling for each retry up to check-interval")
+	pflag.Float64Slice("latitude", nil, "latitude of location to check around, repeat with --longitude to check around any of several")
+	pflag.Float64Slice("longitude", nil, "longitude of location to check around, repeat with --latitude to check around any of several")
+	pflag.String("address", "", "street address to check around, instead of --latitude/--longitude")
+	pflag.Bool("geolocate", false, "look up roughly where we are from our IP address if no location is given")
+	pflag.String("geolocate-url", defaultGeolocateURL, "IP geolocation service for --geolocate, returning JSON with city, latitude and longitude")
+	pflag.String("geocoder", geocoderNominatim, "service used to look up --address, and the state of each location if --states isn't given")
+	pflag.String("geocode-cache", defaultGeocodeCachePath(), "file to cache looked up addresses in, empty to disable")
+	pflag.Int32("distance", defaultDistance, "distance from location to check, in --distance-unit")
+	pflag.String("distance-algorithm", distanceHaversine, "how to measure distances, haversine, vincenty (more accurate, on the WGS-84 ellipsoid) or equirectangular (a faster approximation)")
+	pflag.Float64("min-distance", 0, "skip sites closer than this to location, in --distance-unit")
+	pflag.StringSlice("zip-codes", nil, "also include sites in these zip codes, whatever their distance")
+	pflag.Bool("zip-codes-and-distance", false, "only include sites that are both within distance and in --zip-codes")
+	pflag.String("distance-unit", defaultDistanceUnit, "unit for --distance and reported distances, km or mi")
+	pflag.Int("max-results", 0, "how many nearby sites to print, closest first (0 = all)")
+	pflag.Bool("include-second-dose-only", false, "If given, include sites that are only giving second doses")
+	pflag.String("appointments-field", "appointments", "property holding each site's array of appointments")
+	pflag.String("appointments-available-field", "appointments_available", "property saying whether a site has appointments")
+	pflag.String("second-dose-only-field", "appointments_available_2nd_dose_only", "property saying whether a site's appointments are only for second doses")
+	pflag.StringSlice("vaccine-types", nil, "only include sites offering one of these vaccines, e.g. pfizer,moderna,jj")
+	pflag.StringSlice("type-map", nil, "text=value mappings for normalizing appointment types, checked before the built-in ones, where value is pfizer, moderna, jj, a dose of 1, 2 or booster, or a pair like pfizer/1, e.g. bnt162b2=pfizer")
+	pflag.Int("min-appointments", 1, "only include sites listing at least this many appointments")
+	pflag.Int("unlisted-appointments", 1, "how many appointments to assume for --min-appointments when a site is available but lists none")
+	pflag.StringSlice("cities", nil, "only include sites in these cities")
+	pflag.StringSlice("exclude-cities", nil, "skip sites in these cities")
+	pflag.StringSlice("provider-include", nil, "only include sites from these provider brands")
+	pflag.StringSlice("provider-exclude", nil, "skip sites from these provider brands, ignored if --provider-include is given")
+	pflag.String("filter", "", "only include sites this expression is true for, over their properties plus distance, appointment_count, appointments, vaccines and soonest_hours, e.g. 'provider_brand_name == \"CVS\" && distance < 5'")
+	pflag.Bool("skip-past", false, "ignore appointments that have already started, and sites left without any")
+	pflag.Duration("max-appointment-age", 0, "with --skip-past, how long after an appointment's time to keep counting it")
+	pflag.String("earliest-date", "", "only include sites with an appointment on or after this date, as YYYY-MM-DD")
+	pflag.String("latest-date", "", "only include sites with an appointment on or before this date, as YYYY-MM-DD")
+	pflag.String("earliest-time", "", "only count appointments at or after this time of day, as HH:MM")
+	pflag.String("latest-time", "", "only count appointments at or before this time of day, as HH:MM")
+	pflag.String("time-layout", time.RFC3339, "Go time layout for parsing appointment times")
+	pflag.String("time-output-layout", "", "Go time layout for printing appointment times, e.g. \"Mon Jan 2 3:04PM MST\", instead of --time-layout")
+	pflag.String("display-timezone", "", "timezone to print appointment times in, defaults to local time")
+	pflag.StringSlice("notifier", []string{notifierHTTP}, "how to notify, any of http, slack, telegram, email, pushover, ntfy or twilio")
+	pflag.String("slack-webhook-url", "", "Slack incoming webhook URL for --notifier slack")
+	pflag.String("telegram-bot-token", "", "Telegram bot token for --notifier telegram")
+	pflag.String("telegram-chat-id", "", "Telegram chat to message for --notifier telegram")
+	pflag.String("smtp-host", "", "SMTP server for --notifier email")
+	pflag.Int("smtp-port", defaultSMTPPort, "SMTP server port for --notifier email")
+	pflag.String("smtp-username", "", "SMTP username for --notifier email, if the server requires auth")
+	pflag.String("smtp-password", "", "SMTP password for --notifier email")
+	pflag.String("email-from", "", "sender address for --notifier email")
+	pflag.StringSlice("email-to", nil, "recipient addresses for --notifier email")
+	pflag.String("twilio-account-sid", "", "Twilio account SID for --notifier twilio")
+	pflag.String("twilio-auth-token", "", "Twilio auth token for --notifier twilio")
+	pflag.String("twilio-from", "", "Twilio phone number to text from for --notifier twilio")
+	pflag.StringSlice("twilio-to", nil, "phone numbers to text for --notifier twilio")
+	pflag.String("pushover-token", "", "Pushover application token for --notifier pushover")
+	pflag.String("pushover-user", "", "Pushover user or group key for --notifier pushover")
+	pflag.Int("pushover-priority", 0, "Pushover message priority, from -2 (lowest) to 2 (emergency)")
+	pflag.String("ntfy-server", defaultNtfyServer, "ntfy server for --notifier ntfy")
+	pflag.String("ntfy-topic", "", "ntfy topic to publish to for --notifier ntfy")
+	pflag.String("ntfy-token", "", "ntfy access token, for servers that require auth")
+	pflag.String("ntfy-priority", "default", "ntfy message priority, min, low, default, high or urgent")
+	pflag.String("notification-url", defaultNotificationURL, "URL to hit when appointments are found")
+	pflag.String("notification-method", defaultNotificationMethod, "HTTP method to hit notification-url with")
+	pflag.StringSlice("notification-params", nil, "query params (or body params for POST) to send with notification, values can use the template fields, e.g. count={{.NewCount}}")
+	pflag.StringSlice("notification-headers", nil, "key:value headers to send with notification, repeat a key for multiple values")
+	pflag.String("notification-content-type", contentTypeForm, "content type of the notification body for POST, "+contentTypeForm+" or "+contentTypeJSON+", or anything when using a body template")
+	pflag.String("notification-body-template", "", "Go text/template for the notification body, rendered against the new sites and check counts")
+	pflag.StringSlice("notification-success-codes", []string{"2xx"}, "HTTP statuses that mean a notification was sent, as codes, ranges like 200-204, or classes like 2xx")
+	pflag.String("notification-template", "", "Go text/template for the message sent by the slack, telegram, email, pushover and ntfy notifiers, rendered like --notification-body-template (default the console format, or a bullet per site for telegram)")
+	pflag.Duration("check-interval", defaultCheckInterval, "how often to check")
+	pflag.Duration("check-interval-jitter", 0, "randomly shorten or lengthen each check interval by up to this much, to spread out load on the upstream")
+	pflag.Duration("shutdown-grace", defaultShutdownGrace, "how long to let a check in progress finish when interrupted before cancelling it")
+	pflag.Bool("test-notification", false, "send a made-up site through each --notifier and exit, with 1 if any of them failed")
+	pflag.Bool("once", false, "check once and exit, with 0 if nothing new was found, 1 if the check failed, or 2 if new sites were found, even if some searches failed")
+	pflag.Bool("exit-on-found", false, "keep checking until new sites are found and notified about, then exit with 0")
+	pflag.String("active-hours-start", "", "time of day to start checking, as HH:MM")
+	pflag.String("active-hours-end", "", "time of day to stop checking, as HH:MM, may be before the start to wrap midnight")
+	pflag.String("timezone", "", "timezone for active hours, defaults to local time")
+	pflag.String("metrics-addr", "", "address to serve Prometheus metrics on, e.g. :9090")
+	pflag.String("health-addr", "", "address to serve /healthz on, e.g. :8080")
+	pflag.Duration("health-staleness", defaultHealthStaleness, "how long since the last successful check before /healthz reports unhealthy")
+	pflag.String("pprof-addr", "", "address to serve pprof profiling on, e.g. localhost:6060")
+	pflag.String("trigger-addr", "", "address to serve /check on, where a POST runs a check right away and responds with the result as JSON, e.g. :8081")
+	pflag.String("otel-endpoint", "", "OTLP/HTTP endpoint to send traces of each check to, as host:port or a URL, e.g. http://localhost:4318")
+	pflag.Bool("silent", false, "skip notification")
+	pflag.String("log-level", "info", "minimum level to log, debug, info, warn or error")
+	pflag.String("log-format", logFormatText, "log format, text or json")
+	pflag.String("color", colorAuto, "color console output, auto (when stdout is a terminal), always or never; json output is never colored")
+	pflag.Float64("close-distance", 0, "sites within this distance, in --distance-unit, are printed in green rather than yellow (default half of --distance)")
+	pflag.String("output", outputText, "output format, text or json (one object per check)")
+	pflag.Duration("notification-timeout", defaultNotificationTimeout, "how long to wait for a notification response")
+	pflag.Duration("notify-batch-window", 0, "collect newly found sites for this long and send them in one notification (0 = notify after each check)")
+	pflag.Int("notification-retries", defaultNotificationRetries, "how many times to retry a failed notification before waiting for the next check")
+	pflag.Duration("notification-retry-delay", defaultNotificationRetryDelay, "delay before the first notification retry, doubling for each retry up to check-interval")
+	pflag.Duration("notify-min-interval", 0, "minimum time between any two notifications, holding newly found sites for the next one and skipping cleared notifications meanwhile (0 = no limit)")
+	pflag.Duration("notify-cooldown", 0, "minimum time before notifying about the same site again, even if it disappears and comes back")
+	pflag.Bool("first-run-silent", false, "don't notify about the sites found by the first check, only those that show up later")
+	pflag.Bool("notify-on-clear", false, "also notify when sites found last time no longer have appointments")
+	pflag.String("line-template", "", "Go text/template each site is printed with, given .Provider, .Address, .City, .State, .Distance, .Unit and .Appointments (default the usual console format)")
+	pflag.Bool("summary-only", false, "only print the summary of each check, not the sites found")
+	pflag.Bool("quiet-when-empty", false, "only log the start and summary of checks that find nearby sites, errors are still logged")
+	pflag.Int("trend-checks", defaultTrendChecks, "log how the nearest site's distance compares with up to this many checks ago (0 = don't)")
+	pflag.Bool("verbose", false, "print every property and appointment detail of nearby sites")
+	pflag.String("proxy", "", "http, https or socks5 proxy URL for outgoing requests, instead of the environment's proxy settings")
+	pflag.Bool("search-insecure-skip-verify", false, "don't verify the search server's certificate, which lets anyone in between read and change the results")
+	pflag.String("search-ca-cert", "", "PEM file of extra CA certificates to trust for search")
+	pflag.Bool("notification-insecure-skip-verify", false, "don't verify the notification server's certificate, which lets anyone in between read and change notifications, including any credentials in them")
+	pflag.String("notification-ca-cert", "", "PEM file of extra CA certificates to trust for notifications, e.g. for a self-signed webhook")
+	pflag.Bool("dry-run", false, "print the notification request instead of sending it")
+	pflag.StringSlice("secret-names", []string{"token", "key", "secret", "password", "auth", "sig"}, "notification params and search and notification headers whose names contain any of these have their values kept out of logs and errors")
+	pflag.Bool("debug-http", false, "log each search and notification request and response, headers and bodies included, with secrets redacted")
+	pflag.String("csv-log", "", "CSV file to append the nearby sites found by each check to")
+	pflag.String("sqlite-db", "", "SQLite database to record every check and the nearby sites it found in")
+	pflag.String("state-file", "", "JSON file to remember notified sites in across restarts")
+	pflag.Duration("state-ttl", defaultStateTTL, "how long to remember notified sites in the state file (0 = forever)")
+	pflag.Bool("notify-once-per-site", false, "only ever notify about each site once, remembering it in --state-file forever, until --reset-notified")
+	pflag.Bool("reset-notified", false, "forget the sites in --state-file that have already been notified about, at startup")
+
+	pflag.String("config", "", "config file to read (.yaml, .json or .toml), instead of looking for ./config.*")
+	pflag.Bool("watch-file", false, "reload the config file when it changes, apart from the few settings that need a restart")
+	pflag.String("env-file", "", ".env file of KEY=value lines to set as environment variables, e.g. VC_TELEGRAM_BOT_TOKEN=..., without overriding any already set")
+
+	pflag.CommandLine.SetNormalizeFunc(flagAliases)
+}
+
+// flagAliases normalizes the other names a flag can be given by to its own name.
+func flagAliases(f *pflag.FlagSet, name string) pflag.NormalizedName {
+	if name == "state" {
+		name = "states"
+	}
+	return pflag.NormalizedName(name)
+}
+
 func validateParams() error {
 	var ret *multierror.Error
 
-	if !viper.IsSet("latitude") {
-		ret = multierror.Append(ret, errMissingLatitude)
+	if useAddress() || needsState() {
+		if _, ok := geocoders[viper.GetString("geocoder")]; !ok {
+			ret = multierror.Append(ret, fmt.Errorf("%w: %s", errUnknownGeocoder, viper.GetString("geocoder")))
+		}
 	}
+	if !useAddress() {
+		lats, latErr := float64Slice("latitude")
+		lons, lonErr := float64Slice("longitude")
+
+		// unset coordinates are missing rather than defaulting to 0,0, and an empty list leaves
+		// no location to search around
+		if !viper.IsSet("latitude") {
+			ret = multierror.Append(ret, errMissingLatitude)
+		} else if latErr != nil {
+			ret = multierror.Append(ret, fmt.Errorf("%w: %v", errInvalidLatitude, latErr))
+		} else if len(lats) == 0 {
+			ret = multierror.Append(ret, fmt.Errorf("%w, the list is empty", errMissingLatitude))
+		}
+		for _, lat := range lats {
+			if lat < -90 || lat > 90 {
+				ret = multierror.Append(ret, fmt.Errorf("%w: %v", errInvalidLatitude, lat))
+			}
+		}
 
-	if !viper.IsSet("longitude") {
-		ret = multierror.Append(ret, errMissingLongitude)
+		if !viper.IsSet("longitude") {
+			ret = multierror.Append(ret, errMissingLongitude)
+		} else if lonErr != nil {
+			ret = multierror.Append(ret, fmt.Errorf("%w: %v", errInvalidLongitude, lonErr))
+		} else if len(lons) == 0 {
+			ret = multierror.Append(ret, fmt.Errorf("%w, the list is empty", errMissingLongitude))
+		}
+		for _, lon := range lons {
+			if lon < -180 || lon > 180 {
+				ret = multierror.Append(ret, fmt.Errorf("%w: %v", errInvalidLongitude, lon))
+			}
+		}
+
+		if len(lats) != len(lons) {
+			ret = multierror.Append(ret, fmt.Errorf("%w: %d latitudes, %d longitudes", errMismatchedLocations, len(lats), len(lons)))
+		}
+	}
+
+	if !viper.GetBool("silent") {
+		for _, n := range notifierNames() {
+			switch n {
+			case notifierHTTP:
+				if viper.GetString("notification-url") == "" {
+					ret = multierror.Append(ret, errMissingNotificationURL)
+				}
+			case notifierSlack:
+				if viper.GetString("slack-webhook-url") == "" {
+					ret = multierror.Append(ret, errMissingSlackWebhookURL)
+				}
+			case notifierTelegram:
+				if viper.GetString("telegram-bot-token") == "" {
+					ret = multierror.Append(ret, errMissingTelegramBotToken)
+				}
+				if viper.GetString("telegram-chat-id") == "" {
+					ret = multierror.Append(ret, errMissingTelegramChatID)
+				}
+			case notifierEmail:
+				if viper.GetString("smtp-host") == "" {
+					ret = multierror.Append(ret, errMissingSMTPHost)
+				}
+				if viper.GetString("email-from") == "" {
+					ret = multierror.Append(ret, errMissingEmailFrom)
+				}
+				if len(viper.GetStringSlice("email-to")) == 0 {
+					ret = multierror.Append(ret, errMissingEmailTo)
+				}
+			case notifierPushover:
+				if viper.GetString("pushover-token") == "" {
+					ret = multierror.Append(ret, errMissingPushoverToken)
+				}
+				if viper.GetString("pushover-user") == "" {
+					ret = multierror.Append(ret, errMissingPushoverUser)
+				}
+				if p := viper.GetInt("pushover-priority"); p < pushoverMinPriority || p > pushoverMaxPriority {
+					ret = multierror.Append(ret, errInvalidPushoverPriority)
+				}
+			case notifierNtfy:
+				if viper.GetString("ntfy-topic") == "" {
+					ret = multierror.Append(ret, errMissingNtfyTopic)
+				}
+			case notifierTwilio:
+				if viper.GetString("twilio-account-sid") == "" {
+					ret = multierror.Append(ret, errMissingTwilioAccountSID)
+				}
+				if viper.GetString("twilio-auth-token") == "" {
+					ret = multierror.Append(ret, errMissingTwilioAuthToken)
+				}
+				if viper.GetString("twilio-from") == "" {
+					ret = multierror.Append(ret, errMissingTwilioFrom)
+				}
+				if len(viper.GetStringSlice("twilio-to")) == 0 {
+					ret = multierror.Append(ret, errMissingTwilioTo)
+				}
+			default:
+				ret = multierror.Append(ret, fmt.Errorf("%w: %s", errUnknownNotifier, n))
+			}
+		}
+	}
+
+	if _, ok := distanceUnits[viper.GetString("distance-unit")]; !ok {
+		ret = multierror.Append(ret, errInvalidDistanceUnit)
+	}
+
+	if _, err := parseLogLevel(viper.GetString("log-level")); err != nil {
+		ret = multierror.Append(ret, err)
+	}
+
+	switch f := viper.GetString("log-format"); f {
+	case logFormatText, logFormatJSON:
+	default:
+		ret = multierror.Append(ret, fmt.Errorf("%w: %s", errInvalidLogFormat, f))
+	}
+
+	if _, err := parseActiveHours(viper.GetString("active-hours-start"), viper.GetString("active-hours-end"), viper.GetString("timezone")); err != nil {
+		ret = multierror.Append(ret, err)
+	}
+
+	if _, err := appointmentWindowFromConfig(); err != nil {
+		ret = multierror.Append(ret, err)
+	}
+
+	if _, err := loadLocation(viper.GetString("display-timezone")); err != nil {
+		ret = multierror.Append(ret, fmt.Errorf("%w: %v", errInvalidDisplayTimezone, err))
+	}
+
+	if _, err := compileFilter(); err != nil {
+		ret = multierror.Append(ret, err)
+	}
+
+	if _, err := successStatus(http.StatusOK, viper.GetStringSlice("notification-success-codes")); err != nil {
+		ret = multierror.Append(ret, err)
+	}
+
+	if _, err := typeMap(); err != nil {
+		ret = multierror.Append(ret, err)
+	}
+
+	if a := viper.GetString("distance-algorithm"); distanceFuncs[a] == nil {
+		ret = multierror.Append(ret, fmt.Errorf("%w: %s", errInvalidDistanceAlgorithm, a))
+	}
+
+	if d := viper.GetFloat64("min-distance"); d < 0 || d > viper.GetFloat64("distance") {
+		ret = multierror.Append(ret, fmt.Errorf("%w: %v", errInvalidMinDistance, d))
+	}
+
+	if j := viper.GetDuration("check-interval-jitter"); j < 0 || j > viper.GetDuration("check-interval") {
+		ret = multierror.Append(ret, fmt.Errorf("%w: %v", errInvalidJitter, j))
+	}
+
+	if g := viper.GetDuration("shutdown-grace"); g < 0 {
+		ret = multierror.Append(ret, fmt.Errorf("%w: %v", errInvalidShutdownGrace, g))
+	}
+
+	if i := viper.GetDuration("notify-min-interval"); i < 0 {
+		ret = multierror.Append(ret, fmt.Errorf("%w: %v", errInvalidNotifyInterval, i))
+	}
+
+	if (viper.GetBool("notify-once-per-site") || viper.GetBool("reset-notified")) && viper.GetString("state-file") == "" {
+		ret = multierror.Append(ret, errMissingStateFile)
+	}
+
+	if viper.GetString("next-field") != "" && viper.GetString("page-param") != "" {
+		ret = multierror.Append(ret, errConflictingPagination)
+	}
+
+	if a := viper.GetDuration("max-appointment-age"); a < 0 {
+		ret = multierror.Append(ret, fmt.Errorf("%w: %v", errInvalidAppointmentAge, a))
+	}
+
+	if n := viper.GetInt("trend-checks"); n < 0 {
+		ret = multierror.Append(ret, fmt.Errorf("%w: %v", errInvalidTrendChecks, n))
+	}
+
+	if _, err := searchTargets(); err != nil {
+		ret = multierror.Append(ret, err)
+	}
+
+	if _, err := parseProxy(viper.GetString("proxy")); err != nil {
+		ret = multierror.Append(ret, err)
 	}
 
-	if !viper.GetBool("silent") && viper.GetString("notification-url") == "" {
-		ret = multierror.Append(ret, errMissingNotificationURL)
+	if e := viper.GetString("otel-endpoint"); e != "" {
+		if _, err := otlpOptions(e); err != nil {
+			ret = multierror.Append(ret, err)
+		}
+	}
+
+	for _, prefix := range []string{"search", "notification"} {
+		if _, err := tlsConfig(prefix); err != nil {
+			ret = multierror.Append(ret, err)
+		}
+	}
+
+	switch c := viper.GetString("color"); c {
+	case colorAuto, colorAlways, colorNever:
+	default:
+		ret = multierror.Append(ret, fmt.Errorf("%w: %s", errInvalidColor, c))
+	}
+
+	if d := viper.GetFloat64("close-distance"); d < 0 {
+		ret = multierror.Append(ret, fmt.Errorf("%w: %v", errInvalidCloseDistance, d))
+	}
+
+	switch o := viper.GetString("output"); o {
+	case outputText, outputJSON:
+	default:
+		ret = multierror.Append(ret, fmt.Errorf("%w: %s", errInvalidOutput, o))
+	}
+
+	contentTypeKeys := []string{"search-content-type"}
+
+	for _, p := range viper.GetStringSlice("notification-params") {
+		if strings.Contains(p, "{{") {
+			if _, err := parseTemplate("notification-params", p); err != nil {
+				ret = multierror.Append(ret, fmt.Errorf("invalid --notification-params %q: %w", p, err))
+			}
+		}
+	}
+
+	if _, err := lineTemplate(); err != nil {
+		ret = multierror.Append(ret, fmt.Errorf("invalid --line-template: %w", err))
+	}
+
+	if _, err := parseTemplate("notification-template", notificationTemplate()); err != nil {
+		ret = multierror.Append(ret, fmt.Errorf("invalid --notification-template: %w", err))
+	}
+
+	if text := viper.GetString("notification-body-template"); text != "" {
+		if _, err := parseTemplate("notification-body-template", text); err != nil {
+			ret = multierror.Append(ret, fmt.Errorf("invalid --notification-body-template: %w", err))
+		}
+	} else {
+		contentTypeKeys = append(contentTypeKeys, "notification-content-type")
+	}
+
+	for _, key := range contentTypeKeys {
+		switch ct := viper.GetString(key); ct {
+		case contentTypeForm, contentTypeJSON:
+		default:
+			ret = multierror.Append(ret, fmt.Errorf("%w for --%s: %s", errInvalidContentType, key, ct))
+		}
+	}
+
+	for _, key := range []string{"search-headers", "notification-headers"} {
+		if _, err := parseHeaders(viper.GetStringSlice(key)); err != nil {
+			ret = multierror.Append(ret, fmt.Errorf("--%s: %w", key, err))
+		}
 	}
 
 	return ret.ErrorOrNil()
 }
 
+// onceExitCode is what --once exits with after a check: exitCodeFound if it found new
+// sites, even if some searches failed, or else exitCodeError if it failed.
+func onceExitCode(result *CheckResult, err error) int {
+	switch {
+	case result != nil && result.New > 0:
+		return exitCodeFound
+	case err != nil:
+		return exitCodeError
+	}
+	return exitCodeOK
+}
+
+// notifiedNew reports whether a check notified about new sites or queued them for a batch,
+// which a check where some searches failed can still have done.
+func notifiedNew(result *CheckResult) bool {
+	return result != nil && result.Notified+result.Queued > 0
+}
+
+// nextCheck is how long to wait after a check that returned err, backing off for longer if
+// the upstream asked us to.
+func nextCheck(err error, log zerolog.Logger) time.Duration {
+	d := jitter(viper.GetDuration("check-interval"), viper.GetDuration("check-interval-jitter"))
+
+	var rl *rateLimitedError
+	if errors.As(err, &rl) && rl.retryAfter > d {
+		log.Warn().Dur("delay", rl.retryAfter).Msgf("rate limited, waiting %v before the next check", rl.retryAfter)
+		return rl.retryAfter
+	}
+	return d
+}
+
+// jitter randomly moves d by up to band in either direction.
+func jitter(d, band time.Duration) time.Duration {
+	if band <= 0 {
+		return d
+	}
+	return d - band + time.Duration(rand.Int63n(2*int64(band)+1))
+}
+
+// stringArray gets a StringArray flag, which viper doesn't know how to read, unless it
+// was only set in the config.
+func stringArray(key string) []string {
+	if f := pflag.Lookup(key); f == nil || !f.Changed {
+		if viper.IsSet(key) {
+			return viper.GetStringSlice(key)
+		}
+	}
+	v, _ := pflag.CommandLine.GetStringArray(key)
+	return v
+}
+
+// float64Slice gets a Float64Slice flag, which viper can't read either, unless it was set
+// some other way: a single value or list in the config, a comma-separated list in the
+// environment, or viper.Set.
+func float64Slice(key string) ([]float64, error) {
+	if f := pflag.Lookup(key); (f == nil || !f.Changed) && viper.IsSet(key) {
+		var values []string
+
+		switch v := viper.Get(key).(type) {
+		case []interface{}:
+			values = viper.GetStringSlice(key)
+		case string:
+			values = strings.Split(v, ",")
+		default:
+			return []float64{viper.GetFloat64(key)}, nil
+		}
+
+		ret := make([]float64, 0, len(values))
+
+		for _, s := range values {
+			n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, n)
+		}
+		return ret, nil
+	}
+	return pflag.CommandLine.GetFloat64Slice(key)
+}
+
+// homeLocations pairs up the validated --latitude and --longitude.
+func homeLocations() orb.MultiPoint {
+	lats, _ := float64Slice("latitude")
+	lons, _ := float64Slice("longitude")
+
+	ret := make(orb.MultiPoint, 0, len(lats))
+
+	for i := range lats {
+		ret = append(ret, orb.Point{lons[i], lats[i]})
+	}
+	return ret
+}
+
+// useAddress reports whether to look up --address, which is only used when no coordinates
+// were given.
+func useAddress() bool {
+	return viper.GetString("address") != "" && !viper.IsSet("latitude") && !viper.IsSet("longitude")
+}
+
+// meters in each supported --distance-unit
+var distanceUnits = map[string]float64{
+	"km": metersPerKilometer,
+	"mi": metersPerMile,
+}
+
 // for mocking
 var (
 	exitFunc = os.Exit
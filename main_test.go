@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+var defineFlagsOnce sync.Once
+
+// setConfig resets viper to the flag defaults with settings on top, for the length of the
+// test.
+func setConfig(t testing.TB, settings map[string]interface{}) {
+	t.Helper()
+
+	defineFlagsOnce.Do(defineFlags)
+
+	viper.Reset()
+	viper.BindPFlags(pflag.CommandLine)
+
+	for k, v := range settings {
+		viper.Set(k, v)
+	}
+	t.Cleanup(viper.Reset)
+}
+
+func TestValidateParamsCoordinates(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		settings map[string]interface{}
+		want     error
+	}{
+		{"missing latitude", map[string]interface{}{"longitude": "-74"}, errMissingLatitude},
+		{"missing longitude", map[string]interface{}{"latitude": "40"}, errMissingLongitude},
+		{"latitude out of range", map[string]interface{}{"latitude": "200", "longitude": "-74"}, errInvalidLatitude},
+		{"longitude out of range", map[string]interface{}{"latitude": "40", "longitude": "500"}, errInvalidLongitude},
+		{"mismatched", map[string]interface{}{"latitude": "40,41", "longitude": "-74"}, errMismatchedLocations},
+		{"empty latitude", map[string]interface{}{"latitude": []interface{}{}, "longitude": []interface{}{}}, errMissingLatitude},
+		{"empty longitude", map[string]interface{}{"latitude": []interface{}{}, "longitude": []interface{}{}}, errMissingLongitude},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// as from the environment; no --states, so the state is looked up as well
+			setConfig(t, tc.settings)
+			if !needsState() {
+				t.Fatal("needsState() = false, want true")
+			}
+
+			if err := validateParams(); !errors.Is(err, tc.want) {
+				t.Errorf("validateParams() = %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestStateFlagAlias(t *testing.T) {
+	setConfig(t, nil)
+
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	fs.StringSlice("states", nil, "")
+	fs.SetNormalizeFunc(flagAliases)
+
+	if err := fs.Parse([]string{"--state=NJ"}); err != nil {
+		t.Fatal(err)
+	}
+	viper.BindPFlags(fs)
+
+	if got := viper.GetStringSlice("states"); len(got) != 1 || got[0] != "NJ" {
+		t.Errorf("states = %v, want [NJ]", got)
+	}
+}
+
+func TestNotifiedNewAfterPartialCheck(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	errSearch := errors.New("search failed")
+
+	source := &memorySource{features: []*geojson.Feature{testSite(1, orb.Point{-74.01, 40.71})}, err: errSearch}
+	c := newTestChecker(t, source, map[string]interface{}{
+		"silent":           false,
+		"notifier":         []string{notifierHTTP},
+		"notification-url": srv.URL,
+	})
+
+	// the site the searches that worked found is notified about, so --exit-on-found exits
+	result, err := c.Check(context.Background())
+	if !errors.Is(err, errSearch) {
+		t.Errorf("got %v, want %v", err, errSearch)
+	}
+	if !notifiedNew(result) {
+		t.Errorf("got %+v, want the new site notified", result)
+	}
+
+	if notifiedNew(nil) {
+		t.Error("notifiedNew(nil) = true, want false")
+	}
+}
+
+func TestOnceExitCode(t *testing.T) {
+	errSearch := errors.New("search failed")
+
+	tests := []struct {
+		name   string
+		result *CheckResult
+		err    error
+		want   int
+	}{
+		{"nothing new", &CheckResult{Nearby: 1}, nil, exitCodeOK},
+		{"new", &CheckResult{New: 1}, nil, exitCodeFound},
+		{"new, some searches failed", &CheckResult{New: 1}, errSearch, exitCodeFound},
+		{"nothing new, some searches failed", &CheckResult{}, errSearch, exitCodeError},
+		{"failed", nil, errSearch, exitCodeError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := onceExitCode(tt.result, tt.err); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
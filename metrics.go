@@ -0,0 +1,42 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const metricsNamespace = "vaccine_checker"
+
+var (
+	checksTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "checks_total",
+		Help:      "Number of checks performed.",
+	})
+	lastAvailable = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "available_sites",
+		Help:      "Number of sites with available appointments at the last check.",
+	})
+	lastNearby = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "nearby_sites",
+		Help:      "Number of nearby sites with available appointments at the last check.",
+	})
+	nearestSite = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "nearest_site_meters",
+		Help:      "Distance to the nearest nearby site with available appointments at the last check, NaN if there were none.",
+	})
+	notificationsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "notifications_total",
+		Help:      "Number of notifications sent.",
+	})
+	searchDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "search_duration_seconds",
+		Help:      "Latency of search requests, up to the response headers.",
+		Buckets:   prometheus.DefBuckets,
+	})
+)
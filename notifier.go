@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/spf13/viper"
+)
+
+const (
+	notifierHTTP     = "http"
+	notifierSlack    = "slack"
+	notifierTelegram = "telegram"
+	notifierEmail    = "email"
+	notifierPushover = "pushover"
+	notifierNtfy     = "ntfy"
+	notifierTwilio   = "twilio"
+)
+
+// events a notification can be about
+const (
+	eventFound   = "found"
+	eventCleared = "cleared"
+)
+
+var (
+	errUnknownNotifier = errors.New("unknown notifier")
+)
+
+// Notifier sends a notification about newly found sites.
+type Notifier interface {
+	Notify(ctx context.Context, found []*geojson.Feature) error
+}
+
+// namedNotifier is a Notifier with the --notifier name it was set up from, which is how
+// what each one has already been sent is kept track of.
+type namedNotifier struct {
+	name string
+	Notifier
+}
+
+// nopNotifier is used for --silent.
+type nopNotifier struct{}
+
+func (nopNotifier) Notify(ctx context.Context, found []*geojson.Feature) error {
+	return nil
+}
+
+// notifierNames are the --notifier values, which can also be comma-separated when they come
+// from the environment or config file.
+func notifierNames() []string {
+	var ret []string
+
+	for _, v := range viper.GetStringSlice("notifier") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				ret = append(ret, name)
+			}
+		}
+	}
+	return ret
+}
+
+func newNotifier(name string, client *http.Client, locations orb.MultiPoint, unit string) (Notifier, error) {
+	switch name {
+	case notifierHTTP:
+		return NewHTTPNotifier(client, locations), nil
+	case notifierSlack:
+		return newSlackNotifier(client, locations, unit), nil
+	case notifierTelegram:
+		return newTelegramNotifier(client, locations, unit), nil
+	case notifierEmail:
+		return newEmailNotifier(locations, unit), nil
+	case notifierPushover:
+		return newPushoverNotifier(client, locations, unit), nil
+	case notifierNtfy:
+		return newNtfyNotifier(client, locations, unit), nil
+	case notifierTwilio:
+		return newTwilioNotifier(client, locations, unit), nil
+	}
+	return nil, fmt.Errorf("%w: %s", errUnknownNotifier, name)
+}
+
+type eventKey struct{}
+
+// withEvent marks the notification sent with ctx as being about event, rather than found sites.
+func withEvent(ctx context.Context, event string) context.Context {
+	return context.WithValue(ctx, eventKey{}, event)
+}
+
+func eventFrom(ctx context.Context) string {
+	if event, ok := ctx.Value(eventKey{}).(string); ok {
+		return event
+	}
+	return eventFound
+}
+
+// notificationTitle sums up a notification about n sites.
+func notificationTitle(ctx context.Context, n int) string {
+	if eventFrom(ctx) == eventCleared {
+		return fmt.Sprintf("%d vaccine appointment sites no longer available", n)
+	}
+	return fmt.Sprintf("Found %d new vaccine appointment sites", n)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/spf13/viper"
+)
+
+const defaultNtfyServer = "https://ntfy.sh"
+
+// ntfyNotifier publishes found sites to an ntfy topic.
+type ntfyNotifier struct {
+	client    *http.Client
+	server    string
+	topic     string
+	token     string
+	priority  string
+	locations orb.MultiPoint
+	unit      string
+}
+
+func newNtfyNotifier(client *http.Client, locations orb.MultiPoint, unit string) *ntfyNotifier {
+	return &ntfyNotifier{
+		client:    client,
+		server:    strings.TrimSuffix(viper.GetString("ntfy-server"), "/"),
+		topic:     viper.GetString("ntfy-topic"),
+		token:     viper.GetString("ntfy-token"),
+		priority:  viper.GetString("ntfy-priority"),
+		locations: locations,
+		unit:      unit,
+	}
+}
+
+func (n *ntfyNotifier) Notify(ctx context.Context, found []*geojson.Feature) error {
+	text, err := notificationText(ctx, found, n.locations)
+	if err != nil {
+		return err
+	}
+
+	headers := []string{
+		"Title: " + notificationTitle(ctx, len(found)),
+		"Priority: " + n.priority,
+	}
+	if n.token != "" {
+		headers = append(headers, "Authorization: Bearer "+n.token)
+	}
+
+	req, err := newRequestWithBody(
+		ctx,
+		http.MethodPost,
+		n.server+"/"+n.topic,
+		strings.NewReader(text),
+		"text/plain; charset=utf-8",
+		headers,
+	)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+
+	_, err = sendNotification(ctx, n.client, req)
+	return err
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/spf13/viper"
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+var (
+	errInvalidOutput = errors.New("invalid --output, should be text or json")
+)
+
+type checkOutput struct {
+	Timestamp time.Time       `json:"timestamp"`
+	Counts    *CheckResult    `json:"counts"`
+	Features  []outputFeature `json:"features"`
+}
+
+type outputFeature struct {
+	ID           int                 `json:"id"`
+	Provider     string              `json:"provider"`
+	Address      string              `json:"address"`
+	City         string              `json:"city"`
+	State        string              `json:"state"`
+	DistanceKM   float64             `json:"distance_km"`
+	Appointments []outputAppointment `json:"appointments"`
+}
+
+type outputAppointment struct {
+	Time    string `json:"time"`
+	Type    string `json:"type"`
+	Vaccine string `json:"vaccine"`        // Type normalized, pfizer, moderna, jj or unknown
+	Dose    string `json:"dose,omitempty"` // 1, 2 or booster, if Type says
+}
+
+// Canonical is the normalized type for templates, e.g. "pfizer dose 1", or nothing if the
+// vaccine isn't known.
+func (a outputAppointment) Canonical() string {
+	return apptType{Vaccine: a.Vaccine, Dose: a.Dose}.String()
+}
+
+func newOutputAppointment(at, typ string, mappings []typeMapping) outputAppointment {
+	t := normalizeType(typ, mappings)
+	return outputAppointment{Time: at, Type: typ, Vaccine: t.Vaccine, Dose: t.Dose}
+}
+
+func jsonOutput() bool {
+	return viper.GetString("output") == outputJSON
+}
+
+// textOut is where human-readable progress goes, which is stderr when stdout is
+// reserved for JSON.
+func textOut() io.Writer {
+	if jsonOutput() {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// writeCheckOutput writes the results of a check as a single line of JSON.
+func writeCheckOutput(w io.Writer, result *CheckResult, found []*geojson.Feature, locations orb.MultiPoint, mappings []typeMapping) error {
+	out := checkOutput{
+		Timestamp: time.Now(),
+		Counts:    result,
+		Features:  []outputFeature{},
+	}
+
+	for _, f := range found {
+		out.Features = append(out.Features, newOutputFeature(f, locations, mappings))
+	}
+
+	// Encode adds the trailing newline
+	return json.NewEncoder(w).Encode(out)
+}
+
+func newOutputFeature(f *geojson.Feature, locations orb.MultiPoint, mappings []typeMapping) outputFeature {
+	ret := outputFeature{
+		ID:           featureID(f),
+		Provider:     f.Properties.MustString("provider_brand_name", ""),
+		Address:      f.Properties.MustString("address", ""),
+		City:         f.Properties.MustString("city", ""),
+		State:        f.Properties.MustString("state", ""),
+		DistanceKM:   nearestDistance(f.Geometry.(orb.Point), locations) / metersPerKilometer,
+		Appointments: []outputAppointment{},
+	}
+
+	for _, fields := range sortedAppointments(f, viper.GetString("time-layout")) {
+		at, _ := mapString(fields, "time", "").(string)
+		typ, _ := mapString(fields, "type", "").(string)
+
+		ret.Appointments = append(ret.Appointments, newOutputAppointment(at, typ, mappings))
+	}
+	return ret
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/spf13/viper"
+)
+
+const (
+	pushoverAPIURL = "https://api.pushover.net/1/messages.json"
+
+	pushoverMinPriority       = -2
+	pushoverMaxPriority       = 2
+	pushoverEmergencyPriority = 2
+
+	// how often, and for how long, in seconds, emergency notifications are repeated until acknowledged
+	pushoverEmergencyRetry  = 60
+	pushoverEmergencyExpire = 3600
+)
+
+var (
+	errPushoverFailed          = errors.New("pushover request failed")
+	errInvalidPushoverPriority = errors.New("invalid --pushover-priority, should be from -2 to 2")
+)
+
+// pushoverNotifier sends found sites as a Pushover message.
+type pushoverNotifier struct {
+	client    *http.Client
+	token     string
+	user      string
+	priority  int
+	locations orb.MultiPoint
+	unit      string
+}
+
+func newPushoverNotifier(client *http.Client, locations orb.MultiPoint, unit string) *pushoverNotifier {
+	return &pushoverNotifier{
+		client:    client,
+		token:     viper.GetString("pushover-token"),
+		user:      viper.GetString("pushover-user"),
+		priority:  viper.GetInt("pushover-priority"),
+		locations: locations,
+		unit:      unit,
+	}
+}
+
+func (n *pushoverNotifier) Notify(ctx context.Context, found []*geojson.Feature) error {
+	text, err := notificationText(ctx, found, n.locations)
+	if err != nil {
+		return err
+	}
+
+	form := url.Values{
+		"token":    {n.token},
+		"user":     {n.user},
+		"title":    {notificationTitle(ctx, len(found))},
+		"message":  {text},
+		"priority": {strconv.Itoa(n.priority)},
+	}
+	if n.priority == pushoverEmergencyPriority {
+		form.Set("retry", strconv.Itoa(pushoverEmergencyRetry))
+		form.Set("expire", strconv.Itoa(pushoverEmergencyExpire))
+	}
+
+	req, err := newRequestWithBody(ctx, http.MethodPost, pushoverAPIURL, strings.NewReader(form.Encode()), contentTypeForm, nil)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+
+	b, err := sendNotification(ctx, n.client, req)
+	if err != nil || b == nil {
+		return err
+	}
+
+	var resp struct {
+		Status int      `json:"status"`
+		Errors []string `json:"errors"`
+	}
+
+	if err := json.Unmarshal(b, &resp); err != nil {
+		return fmt.Errorf("error parsing pushover response: %w", err)
+	}
+	if resp.Status != 1 {
+		return fmt.Errorf("%w: %s", errPushoverFailed, strings.Join(resp.Errors, "; "))
+	}
+	return nil
+}
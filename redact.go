@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	redacted = "(redacted)"
+
+	// shorter values, like a bare "1", would scrub far more than the secret
+	minSecretLen = 4
+)
+
+// secretKeys are the settings that are secrets in their own right.
+var secretKeys = []string{
+	"slack-webhook-url",
+	"telegram-bot-token",
+	"smtp-password",
+	"twilio-auth-token",
+	"pushover-token",
+	"pushover-user",
+	"ntfy-token",
+}
+
+// secretLists are the key=value or key:value settings with values that are secrets if their
+// keys look like one of --secret-names.
+var secretLists = []string{"notification-params", "notification-headers", "search-headers"}
+
+var secrets struct {
+	sync.RWMutex
+	values []string // longest first, so a secret containing another is scrubbed whole
+}
+
+// registerSecrets adds the secret values in the settings to what redactSecrets scrubs. It's
+// called at startup and on each reload; values no longer set are kept, as they may still
+// turn up in a check already under way.
+func registerSecrets() {
+	var values []string
+
+	for _, k := range secretKeys {
+		values = append(values, viper.GetString(k))
+	}
+
+	for _, key := range secretLists {
+		for _, entry := range viper.GetStringSlice(key) {
+			i := strings.IndexAny(entry, "=:")
+			if i < 0 || !secretName(entry[:i]) {
+				continue
+			}
+			// a template's rendered value isn't known until it's sent
+			if v := strings.TrimSpace(entry[i+1:]); !strings.Contains(v, "{{") {
+				values = append(values, v)
+			}
+		}
+	}
+
+	secrets.Lock()
+	defer secrets.Unlock()
+
+	seen := make(map[string]bool, len(secrets.values))
+	for _, v := range secrets.values {
+		seen[v] = true
+	}
+
+	for _, v := range values {
+		// as it appears in a query string too
+		for _, s := range []string{v, url.QueryEscape(v)} {
+			if len(s) >= minSecretLen && !seen[s] {
+				seen[s] = true
+				secrets.values = append(secrets.values, s)
+			}
+		}
+	}
+	sort.SliceStable(secrets.values, func(i, j int) bool { return len(secrets.values[i]) > len(secrets.values[j]) })
+}
+
+// secretName is whether a param or header named name holds a secret, going by
+// --secret-names.
+func secretName(name string) bool {
+	name = strings.ToLower(strings.TrimSpace(name))
+
+	for _, s := range viper.GetStringSlice("secret-names") {
+		if s != "" && strings.Contains(name, strings.ToLower(s)) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactSecrets replaces any registered secret values in s, for logging it or putting it in
+// an error.
+func redactSecrets(s string) string {
+	secrets.RLock()
+	defer secrets.RUnlock()
+
+	for _, v := range secrets.values {
+		s = strings.ReplaceAll(s, v, redacted)
+	}
+	return s
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/paulmach/orb"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+// restartKeys are only read at startup, so changing them in the config file does nothing
+// until the next restart.
+var restartKeys = map[string]bool{
+	"config":             true,
+	"env-file":           true,
+	"watch-file":         true,
+	"metrics-addr":       true,
+	"health-addr":        true,
+	"health-staleness":   true,
+	"pprof-addr":         true,
+	"trigger-addr":       true,
+	"otel-endpoint":      true,
+	"state-file":         true,
+	"state-ttl":          true,
+	"sqlite-db":          true,
+	"log-level":          true,
+	"log-format":         true,
+	"once":               true,
+	"shutdown-grace":     true,
+	"active-hours-start": true,
+	"active-hours-end":   true,
+	"timezone":           true,
+}
+
+// locationKeys are the settings the home locations come from.
+var locationKeys = []string{"latitude", "longitude", "address", "geocoder"}
+
+// watchConfig reloads checker whenever the config file changes. lookupStates is whether
+// --states was looked up from the locations, and so needs looking up again if they move.
+//
+// It watches the file itself rather than leaving it to viper.WatchConfig, so the file is
+// only read again once any check in progress is done, and nothing reads the settings while
+// they change.
+func watchConfig(checker *Checker, lookupStates bool, log zerolog.Logger) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("error watching config file: %w", err)
+	}
+
+	var (
+		file        = filepath.Clean(viper.ConfigFileUsed())
+		realFile, _ = filepath.EvalSymlinks(file)
+		prev        = viper.AllSettings()
+	)
+
+	// the directory, since editors and mounted config maps tend to replace the file rather
+	// than write to it
+	if err := watcher.Add(filepath.Dir(file)); err != nil {
+		watcher.Close()
+		return fmt.Errorf("error watching config file: %w", err)
+	}
+
+	go func() {
+		defer watcher.Close()
+
+		for {
+			select {
+			case e, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				cur, _ := filepath.EvalSymlinks(file)
+				written := filepath.Clean(e.Name) == file && e.Op&(fsnotify.Write|fsnotify.Create) != 0
+				relinked := cur != "" && cur != realFile
+
+				if !written && !relinked {
+					continue
+				}
+				realFile = cur
+
+				checker.withSettings(func() {
+					prev = reloadConfig(checker, lookupStates, prev, log)
+				})
+
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Warn().Err(err).Msg("error watching config file")
+			}
+		}
+	}()
+	return nil
+}
+
+// reloadConfig reads the config file again and reconfigures checker from it, returning the
+// settings to compare the next change against. It has to be run through withSettings.
+func reloadConfig(checker *Checker, lookupStates bool, prev map[string]interface{}, log zerolog.Logger) map[string]interface{} {
+	if err := viper.ReadInConfig(); err != nil {
+		log.Error().Err(err).Msg("error reading config file, not reloading")
+		return prev
+	}
+
+	cur := viper.AllSettings()
+	changed := changedKeys(prev, cur)
+
+	if len(changed) == 0 {
+		return cur
+	}
+	// just the keys, the values could be secrets
+	log.Info().Strs("changed", changed).Msgf("%s changed, reloading", viper.ConfigFileUsed())
+
+	var moved bool
+
+	for _, k := range changed {
+		if restartKeys[k] {
+			log.Warn().Str("key", k).Msgf("changing %s needs a restart, ignoring it until then", k)
+		}
+		for _, lk := range locationKeys {
+			moved = moved || k == lk
+		}
+	}
+
+	registerSecrets()
+
+	if err := validateParams(); err != nil {
+		log.Error().Str("error", redactSecrets(err.Error())).Msg("invalid config, not reloading")
+		return cur
+	}
+
+	locations := homeLocations()
+
+	if useAddress() {
+		p, _, err := geocodeAddress(context.Background(), viper.GetString("geocoder"), viper.GetString("address"), viper.GetString("geocode-cache"))
+		if err != nil {
+			log.Error().Err(err).Msg("error looking up --address, not reloading")
+			return cur
+		}
+		locations = orb.MultiPoint{p}
+	}
+
+	if lookupStates && moved {
+		states, err := locationStates(context.Background(), viper.GetString("geocoder"), locations)
+		if err != nil {
+			log.Error().Err(err).Msg("error looking up the state to search, not reloading")
+			return cur
+		}
+		viper.Set("states", states)
+	}
+
+	unit := viper.GetString("distance-unit")
+	distance := viper.GetFloat64("distance") * distanceUnits[unit]
+
+	if err := checker.configure(newSearchSource(log), locations, distance, unit); err != nil {
+		log.Error().Err(err).Msg("error reloading config")
+		return cur
+	}
+	log.Info().Msg("reloaded config")
+
+	return cur
+}
+
+// changedKeys lists the settings that differ between prev and cur, in order.
+func changedKeys(prev, cur map[string]interface{}) []string {
+	var ret []string
+
+	for k, v := range cur {
+		if !reflect.DeepEqual(prev[k], v) {
+			ret = append(ret, k)
+		}
+	}
+	for k := range prev {
+		if _, ok := cur[k]; !ok {
+			ret = append(ret, k)
+		}
+	}
+	sort.Strings(ret)
+
+	return ret
+}
@@ -0,0 +1,783 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/paulmach/orb/geojson"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
+)
+
+// SearchSource is where a Checker gets sites from. Fetch decodes the sites as it reads
+// them, returning only those keep wants along with how many there were in all, so a big
+// state never has to fit in memory at once.
+type SearchSource interface {
+	Fetch(ctx context.Context, keep func(*geojson.Feature) bool) (*geojson.FeatureCollection, int, error)
+}
+
+var (
+	errInvalidSearchSource     = errors.New("invalid --search-source, should be vaccinespotter or sites, optionally followed by =url-pattern")
+	errInvalidSearchURLPattern = errors.New("search url pattern doesn't have a format verb for each search param")
+	errMismatchedSearchParams  = errors.New("with several --search-url-pattern, give each its own --search-params, or none at all")
+	errMissingSearchURLPattern = errors.New("missing --search-url-pattern")
+)
+
+// searchDecoder turns a search response into features, like decodeFeatures, along with the
+// link to the next page of them if the response gives one.
+type searchDecoder func(r io.Reader, keep func(*geojson.Feature) bool) (*geojson.FeatureCollection, int, string, error)
+
+// the response shapes --search-source can be
+var searchDecoders = map[string]searchDecoder{
+	"vaccinespotter": decodeFeatures,
+	"sites":          decodeSites,
+}
+
+// searchTarget is a URL to search, the params to send in the body if the method takes
+// one, and how to decode what comes back.
+type searchTarget struct {
+	url    string
+	params []string
+	decode searchDecoder
+}
+
+// searchTargets works out what to search for each --search-source. A source given as
+// name=url-pattern uses its own pattern, without params; otherwise it's each of
+// --search-url-pattern with its --search-params.
+func searchTargets() ([]searchTarget, error) {
+	patterns, err := searchPatterns()
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []searchTarget
+
+	for _, s := range viper.GetStringSlice("search-source") {
+		name, ps := sourcePatterns(s, patterns)
+
+		if len(ps) == 0 {
+			return nil, fmt.Errorf("%w, for --search-source %s", errMissingSearchURLPattern, s)
+		}
+
+		decode, ok := searchDecoders[name]
+		if !ok || ps[0].pattern == "" {
+			return nil, fmt.Errorf("%w: %s", errInvalidSearchSource, s)
+		}
+
+		for _, p := range ps {
+			if err := p.check(); err != nil {
+				return nil, err
+			}
+			for _, u := range p.urls() {
+				ret = append(ret, searchTarget{url: u, params: p.params, decode: decode})
+			}
+		}
+	}
+	return ret, nil
+}
+
+// sourcePatterns splits a --search-source into its name and the patterns to search it
+// with, which are its own if it gives one, or else patterns.
+func sourcePatterns(s string, patterns []searchPattern) (string, []searchPattern) {
+	if i := strings.Index(s, "="); i >= 0 {
+		return s[:i], []searchPattern{{pattern: s[i+1:]}}
+	}
+	return s, patterns
+}
+
+// needsState reports whether any pattern has a verb left for the state without --states
+// saying which, so it has to be looked up from the location.
+func needsState() bool {
+	if len(viper.GetStringSlice("states")) > 0 || viper.GetString("search-file") != "" {
+		return false
+	}
+
+	patterns, err := searchPatterns()
+	if err != nil {
+		return false
+	}
+
+	for _, s := range viper.GetStringSlice("search-source") {
+		_, ps := sourcePatterns(s, patterns)
+
+		for _, p := range ps {
+			if p.wantsState() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// searchPattern is a search url pattern with the params it's formatted with.
+type searchPattern struct {
+	pattern string
+	params  []string
+}
+
+// searchPatterns pairs each --search-url-pattern with its --search-params. A single
+// pattern gets all of them; several each get the --search-params given in the same
+// position, as a comma-separated list.
+func searchPatterns() ([]searchPattern, error) {
+	var (
+		patterns = stringArray("search-url-pattern")
+		groups   = stringArray("search-params")
+	)
+
+	if len(patterns) == 1 {
+		return []searchPattern{{pattern: patterns[0], params: splitParams(groups...)}}, nil
+	}
+	if len(groups) > 0 && len(groups) != len(patterns) {
+		return nil, fmt.Errorf("%w: %d patterns, %d --search-params", errMismatchedSearchParams, len(patterns), len(groups))
+	}
+
+	ret := make([]searchPattern, len(patterns))
+
+	for i, p := range patterns {
+		ret[i].pattern = p
+
+		if len(groups) > 0 {
+			ret[i].params = splitParams(groups[i])
+		}
+	}
+	return ret, nil
+}
+
+func splitParams(groups ...string) []string {
+	var ret []string
+
+	for _, g := range groups {
+		if g != "" {
+			ret = append(ret, strings.Split(g, ",")...)
+		}
+	}
+	return ret
+}
+
+// newSearchSource reads --search-file if it's set, and otherwise searches the upstream.
+func newSearchSource(log zerolog.Logger) SearchSource {
+	// validated at startup
+	targets, _ := searchTargets()
+
+	if path := viper.GetString("search-file"); path != "" {
+		decode := searchDecoder(decodeFeatures)
+		if len(targets) > 0 {
+			// in the shape of the first source
+			decode = targets[0].decode
+		}
+		return &fileSource{path: path, decode: decode}
+	}
+
+	// file:// patterns replay saved responses, e.g. file:///tmp/states/%s.json
+	t := newTransport("search")
+	t.RegisterProtocol("file", http.NewFileTransport(http.Dir("/")))
+
+	s := &httpSource{
+		log:     log,
+		targets: targets,
+		client: &http.Client{
+			Timeout:   viper.GetDuration("search-timeout"),
+			Transport: withDebug(t, log.With().Str("client", "search").Logger()),
+		},
+	}
+	if n := viper.GetInt("max-requests-per-minute"); n > 0 {
+		s.limiter = rate.NewLimiter(rate.Limit(float64(n)/60), 1)
+	}
+	return s
+}
+
+// httpSource searches the upstream using the search flags, once for each target.
+type httpSource struct {
+	log     zerolog.Logger
+	client  *http.Client
+	targets []searchTarget
+	limiter *rate.Limiter // nil if unlimited
+
+	// the last response from each url that said how to check it's changed
+	cacheMu sync.Mutex
+	cache   map[string]*cachedPage
+}
+
+// cachedPage is what a search response decoded to, for reusing when the upstream says it
+// hasn't changed. fc has every feature in the response, for keep to filter on each reuse.
+type cachedPage struct {
+	etag         string
+	lastModified string
+	fc           *geojson.FeatureCollection
+	total        int
+	next         string
+}
+
+func (s *httpSource) cached(u string) *cachedPage {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+
+	return s.cache[u]
+}
+
+func (s *httpSource) setCached(u string, p *cachedPage) {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+
+	if s.cache == nil {
+		s.cache = map[string]*cachedPage{}
+	}
+	s.cache[u] = p
+}
+
+func (s *httpSource) Fetch(ctx context.Context, keep func(*geojson.Feature) bool) (*geojson.FeatureCollection, int, error) {
+	return s.fetchAll(ctx, s.targets, keep)
+}
+
+// fetchAll searches each of targets, up to --max-concurrency at a time, and merges the
+// results. It only fails outright if every search fails; otherwise the errors of any that
+// did are returned alongside what the rest found.
+func (s *httpSource) fetchAll(ctx context.Context, targets []searchTarget, keep func(*geojson.Feature) bool) (*geojson.FeatureCollection, int, error) {
+	type fetched struct {
+		fc    *geojson.FeatureCollection
+		total int
+		err   error
+	}
+
+	var (
+		results = make([]fetched, len(targets))
+		sem     = make(chan struct{}, maxInt(viper.GetInt("max-concurrency"), 1))
+		wg      sync.WaitGroup
+	)
+
+	for i, t := range targets {
+		wg.Add(1)
+
+		go func(i int, t searchTarget) {
+			defer wg.Done()
+
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				results[i].err = ctx.Err()
+				return
+			}
+			results[i].fc, results[i].total, results[i].err = s.fetch(ctx, t, keep)
+		}(i, t)
+	}
+	wg.Wait()
+
+	var (
+		merged = geojson.NewFeatureCollection()
+		total  int
+		errs   *multierror.Error
+		ok     bool
+	)
+
+	for i, r := range results {
+		if r.err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("%s: %w", targets[i].url, r.err))
+			continue
+		}
+		ok = true
+		merged.Features = append(merged.Features, r.fc.Features...)
+		total += r.total
+	}
+
+	if !ok {
+		return nil, 0, errs.ErrorOrNil()
+	}
+	return merged, total, errs.ErrorOrNil()
+}
+
+// fetch searches t, following the pages of results by --next-field or --page-param, if
+// either is set, for up to --max-pages.
+func (s *httpSource) fetch(ctx context.Context, t searchTarget, keep func(*geojson.Feature) bool) (*geojson.FeatureCollection, int, error) {
+	var (
+		pageParam = viper.GetString("page-param")
+		maxPages  = maxInt(viper.GetInt("max-pages"), 1)
+		merged    = geojson.NewFeatureCollection()
+		total     int
+		pt        = t
+	)
+
+	for page := 1; ; page++ {
+		if pageParam != "" {
+			u, err := withQueryParam(t.url, pageParam, strconv.Itoa(page))
+			if err != nil {
+				return nil, 0, err
+			}
+			pt.url = u
+		}
+
+		fc, n, next, err := s.fetchPage(ctx, pt, keep)
+		if err != nil {
+			return nil, 0, err
+		}
+		merged.Features = append(merged.Features, fc.Features...)
+		total += n
+
+		// a page param runs until a page comes back empty
+		more := next != ""
+		if pageParam != "" {
+			more = n > 0
+		}
+		if !more {
+			return merged, total, nil
+		}
+		if page >= maxPages {
+			s.log.Warn().Str("url", t.url).Int("pages", page).Msgf("stopping after %d pages of results", page)
+			return merged, total, nil
+		}
+
+		if pageParam == "" {
+			if pt.url, err = resolveURL(pt.url, next); err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+}
+
+// fetchPage searches t, retrying failures with backoff.
+func (s *httpSource) fetchPage(ctx context.Context, t searchTarget, keep func(*geojson.Feature) bool) (*geojson.FeatureCollection, int, string, error) {
+	retries := viper.GetInt("search-retries")
+
+	for attempt := 0; ; attempt++ {
+		fc, total, next, err := s.search(ctx, t, keep)
+		if err == nil {
+			return fc, total, next, nil
+		}
+		if ctx.Err() != nil {
+			// interrupted, no point retrying
+			return nil, 0, "", ctx.Err()
+		}
+		if errors.As(err, new(*rateLimitedError)) {
+			// retrying would only make it worse, leave it for the main loop to back off
+			return nil, 0, "", err
+		}
+		if attempt >= retries {
+			return nil, 0, "", fmt.Errorf("error fetching appointments after %d attempts: %w", attempt+1, err)
+		}
+
+		delay := retryDelay(attempt, viper.GetDuration("search-retry-base-delay"), viper.GetDuration("check-interval"))
+		s.log.Warn().Err(err).Dur("delay", delay).Msgf("error fetching appointments, retrying in %v", delay.Round(time.Millisecond))
+
+		select {
+		case <-ctx.Done():
+			return nil, 0, "", ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// withQueryParam sets the query param key to value in u.
+func withQueryParam(u, key, value string) (string, error) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return "", fmt.Errorf("error parsing search url %s: %w", u, err)
+	}
+	q := parsed.Query()
+	q.Set(key, value)
+	parsed.RawQuery = q.Encode()
+
+	return parsed.String(), nil
+}
+
+// resolveURL resolves the next page link, which may be relative, against the page it
+// came from.
+func resolveURL(base, next string) (string, error) {
+	b, err := url.Parse(base)
+	if err != nil {
+		return "", fmt.Errorf("error parsing search url %s: %w", base, err)
+	}
+	n, err := url.Parse(next)
+	if err != nil {
+		return "", fmt.Errorf("invalid next page link %q: %w", next, err)
+	}
+	return b.ResolveReference(n).String(), nil
+}
+
+// search hits t and decodes the response, failing on anything but a 200.
+func (s *httpSource) search(ctx context.Context, t searchTarget, keep func(*geojson.Feature) bool) (fc *geojson.FeatureCollection, total int, next string, err error) {
+	u := t.url
+
+	ctx, span := tracer.Start(ctx, "search request", trace.WithAttributes(attribute.String("url", u)))
+	defer func() { endSpan(span, err) }()
+
+	if err := s.wait(ctx, u); err != nil {
+		return nil, 0, "", err
+	}
+
+	req, err := newRequest(
+		ctx,
+		viper.GetString("search-method"),
+		u,
+		t.params,
+		viper.GetString("search-content-type"),
+		viper.GetStringSlice("search-headers"),
+	)
+	if err != nil {
+		return nil, 0, "", fmt.Errorf("error creating request: %w", err)
+	}
+	// asking for it ourselves means the transport leaves decompressing to us, so we get to
+	// see how much it saves
+	if req.Header.Get("Accept-Encoding") == "" {
+		req.Header.Set("Accept-Encoding", "gzip")
+	}
+
+	cached := s.cached(u)
+	if cached != nil {
+		if cached.etag != "" {
+			req.Header.Set("If-None-Match", cached.etag)
+		}
+		if cached.lastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.lastModified)
+		}
+	}
+
+	// up to the response headers, leaving out decoding the body and waiting on the limiter
+	start := time.Now()
+	resp, err := s.client.Do(req)
+	searchDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		return nil, 0, "", err
+	}
+	defer resp.Body.Close()
+	span.SetAttributes(attribute.Int("status", resp.StatusCode))
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return nil, 0, "", &rateLimitedError{retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())}
+	}
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		s.log.Debug().Str("url", u).Msg("search response not modified, reusing the last one")
+		span.SetAttributes(attribute.Bool("cached", true))
+
+		return keepFeatures(cached.fc, keep), cached.total, cached.next, nil
+	}
+
+	var (
+		compressed = &countingReader{r: resp.Body}
+		body       = io.Reader(compressed)
+		gzipped    = strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip")
+	)
+
+	if gzipped {
+		zr, err := gzip.NewReader(compressed)
+		if err != nil {
+			return nil, 0, "", fmt.Errorf("error decompressing search response: %s: %w", resp.Status, err)
+		}
+		defer zr.Close()
+		body = zr
+	}
+	decompressed := &countingReader{r: body}
+
+	if resp.StatusCode != http.StatusOK {
+		b, _ := ioutil.ReadAll(io.LimitReader(decompressed, 4096))
+		return nil, 0, "", fmt.Errorf("%w: %s: %s", errInvalidStatusReturned, resp.Status, snippet(b))
+	}
+
+	// the start of the body, for the error if it doesn't decode, as it's usually an HTML
+	// error page sent as a 200
+	br := bufio.NewReader(decompressed)
+	head, _ := br.Peek(snippetLength)
+	head = append([]byte(nil), head...)
+
+	// a response that may be reused is cached whole, as what keep wants can have changed by
+	// the time it is
+	etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	cache := etag != "" || lastModified != ""
+
+	decodeKeep := keep
+	if cache {
+		decodeKeep = keepAll
+	}
+
+	fc, total, next, err = t.decode(br, decodeKeep)
+	if err != nil {
+		return nil, 0, "", fmt.Errorf("error decoding search response: %w: %s", err, snippet(head))
+	}
+	if cache {
+		s.setCached(u, &cachedPage{etag: etag, lastModified: lastModified, fc: fc, total: total, next: next})
+		fc = keepFeatures(fc, keep)
+	}
+	span.SetAttributes(attribute.Int("locations", total), attribute.Int("available", len(fc.Features)))
+
+	if gzipped {
+		s.log.Debug().Str("url", u).Int64("compressed", compressed.n).Int64("decompressed", decompressed.n).Msg("decompressed search response")
+	}
+	return fc, total, next, nil
+}
+
+func keepAll(*geojson.Feature) bool { return true }
+
+// keepFeatures is a new FeatureCollection of the features in fc that keep wants, leaving fc
+// as it is.
+func keepFeatures(fc *geojson.FeatureCollection, keep func(*geojson.Feature) bool) *geojson.FeatureCollection {
+	ret := geojson.NewFeatureCollection()
+
+	for _, f := range fc.Features {
+		if keep(f) {
+			ret.Append(f)
+		}
+	}
+	return ret
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// decodeFeatures decodes a FeatureCollection from r one feature at a time, keeping only
+// those keep wants, and returns them with how many features there were in all, and the
+// --next-field link if there is one.
+func decodeFeatures(r io.Reader, keep func(*geojson.Feature) bool) (*geojson.FeatureCollection, int, string, error) {
+	var (
+		dec       = json.NewDecoder(r)
+		fc        = geojson.NewFeatureCollection()
+		total     int
+		next      string
+		nextField = viper.GetString("next-field")
+	)
+
+	if err := expectDelim(dec, '{'); err != nil {
+		return nil, 0, "", err
+	}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, 0, "", err
+		}
+		if nextField != "" && t == nextField {
+			var link *string
+
+			if err := dec.Decode(&link); err != nil {
+				return nil, 0, "", fmt.Errorf("%s: %w", nextField, err)
+			}
+			if link != nil {
+				next = *link
+			}
+			continue
+		}
+		if t != "features" {
+			// nothing else in there we use
+			var skip json.RawMessage
+
+			if err := dec.Decode(&skip); err != nil {
+				return nil, 0, "", err
+			}
+			continue
+		}
+
+		if err := expectDelim(dec, '['); err != nil {
+			return nil, 0, "", fmt.Errorf("features: %w", err)
+		}
+		for dec.More() {
+			f := &geojson.Feature{}
+
+			if err := dec.Decode(f); err != nil {
+				return nil, 0, "", fmt.Errorf("feature %d: %w", total, err)
+			}
+			total++
+
+			if keep(f) {
+				fc.Features = append(fc.Features, f)
+			}
+		}
+		if err := expectDelim(dec, ']'); err != nil {
+			return nil, 0, "", err
+		}
+	}
+	if err := expectDelim(dec, '}'); err != nil {
+		return nil, 0, "", err
+	}
+	return fc, total, next, nil
+}
+
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	t, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := t.(json.Delim); !ok || d != want {
+		return fmt.Errorf("expected %v, got %v", want, t)
+	}
+	return nil
+}
+
+// wait holds off until --max-requests-per-minute allows another request.
+func (s *httpSource) wait(ctx context.Context, u string) error {
+	if s.limiter == nil {
+		return nil
+	}
+
+	r := s.limiter.Reserve()
+	delay := r.Delay()
+	if delay == 0 {
+		return nil
+	}
+	s.log.Info().Str("url", u).Dur("delay", delay).Msgf("throttling search for %v", delay.Round(time.Millisecond))
+
+	select {
+	case <-ctx.Done():
+		r.Cancel()
+		return ctx.Err()
+	case <-time.After(delay):
+		return nil
+	}
+}
+
+// rateLimitedError is returned when the upstream responds with a 429, with how long it
+// asked us to wait, if it said.
+type rateLimitedError struct {
+	retryAfter time.Duration
+}
+
+func (e *rateLimitedError) Error() string {
+	if e.retryAfter > 0 {
+		return fmt.Sprintf("rate limited by the upstream, retry after %v", e.retryAfter)
+	}
+	return "rate limited by the upstream"
+}
+
+// parseRetryAfter parses a Retry-After header, which is either seconds or an HTTP date,
+// returning zero if it's missing or invalid.
+func parseRetryAfter(s string, now time.Time) time.Duration {
+	if s == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(s); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(s); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// how much of a response body snippet keeps
+const snippetLength = 200
+
+// snippet trims a response body down to something reasonable to log.
+func snippet(b []byte) string {
+	s := strings.TrimSpace(string(b))
+	if len(s) > snippetLength {
+		s = s[:snippetLength] + "..."
+	}
+	return strconv.Quote(s)
+}
+
+// urls formats p with its params. If it has a verb left over for the state, that's once
+// for each of --states, which is added as the last param.
+func (p searchPattern) urls() []string {
+	states := viper.GetStringSlice("states")
+
+	if len(states) == 0 || !p.wantsState() {
+		return []string{searchURL(p.pattern, p.params)}
+	}
+
+	var ret []string
+
+	for _, state := range states {
+		params := append(append([]string(nil), p.params...), state)
+		ret = append(ret, searchURL(p.pattern, params))
+	}
+	return ret
+}
+
+// wantsState is whether p has a verb left over for the state.
+func (p searchPattern) wantsState() bool {
+	return !paramsInBody(viper.GetString("search-method")) && countVerbs(p.pattern) > len(p.params)
+}
+
+// check makes sure p has a format verb for each of its params, and maybe one more for the
+// state, so a mistake fails at startup rather than as a 404 for a URL ending in
+// %!(EXTRA ...). Patterns whose params go in the body are exempt, as is everything when
+// reading --search-file instead.
+func (p searchPattern) check() error {
+	if paramsInBody(viper.GetString("search-method")) || viper.GetString("search-file") != "" {
+		return nil
+	}
+
+	verbs, params := countVerbs(p.pattern), len(p.params)
+	if verbs == params || verbs == params+1 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s has %d, but there are %d search params, plus one for the state", errInvalidSearchURLPattern, p.pattern, verbs, params)
+}
+
+// countVerbs counts the Sprintf directives in pattern, not counting %%.
+func countVerbs(pattern string) int {
+	var n int
+
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '%' {
+			continue
+		}
+		if i+1 < len(pattern) && pattern[i+1] == '%' {
+			i++
+			continue
+		}
+		n++
+	}
+	return n
+}
+
+func searchURL(pattern string, searchParams []string) string {
+	if paramsInBody(viper.GetString("search-method")) {
+		return pattern
+	}
+
+	var params []interface{}
+
+	for _, s := range searchParams {
+		if viper.GetBool("url-encode-params") {
+			// %20 rather than +, which only means a space in a query
+			s = strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+		}
+		params = append(params, s)
+	}
+	return fmt.Sprintf(pattern, params...)
+}
+
+// fileSource reads sites from a saved response, for trying out filters without hitting the
+// upstream.
+type fileSource struct {
+	path   string
+	decode searchDecoder
+}
+
+func (s *fileSource) Fetch(ctx context.Context, keep func(*geojson.Feature) bool) (*geojson.FeatureCollection, int, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error reading search file: %w", err)
+	}
+	defer f.Close()
+
+	// a saved response is a single page
+	fc, total, _, err := s.decode(f, keep)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error decoding search file %s: %w", s.path, err)
+	}
+	return fc, total, nil
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+// memorySource serves a fixed set of sites, along with err as a search failing partway
+// would.
+type memorySource struct {
+	features []*geojson.Feature
+	err      error
+}
+
+func (s *memorySource) Fetch(ctx context.Context, keep func(*geojson.Feature) bool) (*geojson.FeatureCollection, int, error) {
+	fc := geojson.NewFeatureCollection()
+
+	for _, f := range s.features {
+		if keep(f) {
+			fc.Append(f)
+		}
+	}
+	return fc, len(s.features), s.err
+}
+
+var testLocation = orb.Point{-74.0, 40.7}
+
+// newTestChecker checks around testLocation, within 10km, without notifying or printing
+// anything unless settings say to. A nil source searches as the settings say.
+func newTestChecker(t *testing.T, source SearchSource, settings map[string]interface{}) *Checker {
+	t.Helper()
+
+	all := map[string]interface{}{"silent": true, "summary-only": true}
+	for k, v := range settings {
+		all[k] = v
+	}
+	setConfig(t, all)
+
+	if source == nil {
+		source = newSearchSource(zerolog.Nop())
+	}
+	c, err := NewChecker(source, orb.MultiPoint{testLocation}, 10*metersPerKilometer, "km", zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// testSite is an available site with an appointment, at g.
+func testSite(id int, g orb.Geometry) *geojson.Feature {
+	f := geojson.NewFeature(g)
+	f.Properties["id"] = float64(id)
+	f.Properties["provider_brand_name"] = "CVS"
+	f.Properties["appointments_available"] = true
+	f.Properties["appointments"] = []interface{}{map[string]interface{}{"time": "2021-05-01T09:00:00-04:00", "type": "Pfizer"}}
+
+	return f
+}
+
+func TestCheckMemorySource(t *testing.T) {
+	source := &memorySource{features: []*geojson.Feature{
+		testSite(1, orb.Point{-74.01, 40.71}),
+		testSite(2, orb.Point{-74.02, 40.72}),
+	}}
+	c := newTestChecker(t, source, nil)
+
+	result, err := c.Check(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Nearby != 2 || result.New != 2 {
+		t.Errorf("first check: got %d nearby, %d new, want 2, 2", result.Nearby, result.New)
+	}
+
+	source.features = append(source.features, testSite(3, orb.Point{-74.03, 40.73}))
+
+	result, err = c.Check(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Nearby != 3 || result.New != 1 || featureID(result.NewFeatures[0]) != 3 {
+		t.Errorf("second check: got %d nearby, %d new, want 3, 1 (id 3)", result.Nearby, result.New)
+	}
+}
+
+func TestCheckMemorySourceError(t *testing.T) {
+	errSearch := errors.New("search failed")
+
+	source := &memorySource{features: []*geojson.Feature{testSite(1, orb.Point{-74.01, 40.71})}, err: errSearch}
+	c := newTestChecker(t, source, nil)
+
+	// what the searches that worked found is still handled
+	result, err := c.Check(context.Background())
+	if !errors.Is(err, errSearch) {
+		t.Errorf("got %v, want %v", err, errSearch)
+	}
+	if result == nil || result.New != 1 {
+		t.Fatalf("got %+v, want 1 new", result)
+	}
+}
+
+func TestFileSource(t *testing.T) {
+	dir, err := filepath.Abs("testdata/states")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		settings map[string]interface{}
+	}{
+		{"search file", map[string]interface{}{"search-file": filepath.Join(dir, "NJ.json")}},
+		{"file url", map[string]interface{}{"search-url-pattern": []string{"file://" + dir + "/%s.json"}, "states": []string{"NJ"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestChecker(t, nil, tt.settings)
+
+			result, err := c.Check(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the fourth site has no appointments, and the third is too far away
+			if result.Available != 3 || result.Nearby != 2 {
+				t.Errorf("got %d available, %d nearby, want 3, 2", result.Available, result.Nearby)
+			}
+		})
+	}
+}
+
+func TestDecodeFeaturesFailsPartway(t *testing.T) {
+	setConfig(t, nil)
+
+	// cut off in the third feature
+	body := `{"type":"FeatureCollection","features":[
+		{"type":"Feature","geometry":{"type":"Point","coordinates":[-74.0,40.7]},"properties":{"id":1}},
+		{"type":"Feature","geometry":{"type":"Point","coordinates":[-74.0,40.7]},"properties":{"id":2}},
+		{"type":"Feature","geometry":{"type":"Point","coordinates":[-74.0,`
+
+	var kept int
+	fc, total, _, err := decodeFeatures(strings.NewReader(body), func(*geojson.Feature) bool {
+		kept++
+		return true
+	})
+
+	if err == nil || !strings.Contains(err.Error(), "feature 2") {
+		t.Errorf("got %v, want an error about feature 2", err)
+	}
+	// the two read before it are thrown away with the rest
+	if fc != nil || total != 0 || kept != 2 {
+		t.Errorf("got %v, %d total after keeping %d, want nothing after keeping 2", fc, total, kept)
+	}
+}
+
+func TestSearchDecodeErrorSnippet(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html><body>down for maintenance</body></html>")
+	}))
+	defer srv.Close()
+
+	c := newTestChecker(t, nil, map[string]interface{}{
+		"search-url-pattern": []string{srv.URL + "/%s.json"},
+		"states":             []string{"NJ"},
+		"search-retries":     0,
+	})
+
+	_, err := c.Check(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "down for maintenance") {
+		t.Errorf("got %v, want the start of the body in the error", err)
+	}
+}
+
+// benchmarkResponse is a search response of 5000 sites, one in ten with appointments.
+func benchmarkResponse() []byte {
+	var buf bytes.Buffer
+
+	buf.WriteString(`{"type":"FeatureCollection","features":[`)
+	for i := 0; i < 5000; i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		fmt.Fprintf(&buf, `{"type":"Feature","geometry":{"type":"Point","coordinates":[-74.0,40.7]},"properties":{"id":%d,"provider_brand_name":"CVS","address":"%d Main","city":"Hoboken","state":"NJ","appointments_available":%t,"appointments":[{"time":"2021-05-01T09:00:00-04:00","type":"Pfizer"},{"time":"2021-05-01T09:15:00-04:00","type":"Moderna"}]}}`, i, i, i%10 == 0)
+	}
+	buf.WriteString(`]}`)
+
+	return buf.Bytes()
+}
+
+func benchmarkKeep(f *geojson.Feature) bool {
+	return f.Properties.MustBool("appointments_available", false)
+}
+
+func BenchmarkDecodeFeatures(b *testing.B) {
+	setConfig(b, nil)
+
+	body := benchmarkResponse()
+
+	b.SetBytes(int64(len(body)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, _, _, err := decodeFeatures(bytes.NewReader(body), benchmarkKeep); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkDecodeFeatureCollection decodes the whole response before filtering it, as was
+// done before decodeFeatures, to compare memory use against.
+func BenchmarkDecodeFeatureCollection(b *testing.B) {
+	setConfig(b, nil)
+
+	body := benchmarkResponse()
+
+	b.SetBytes(int64(len(body)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		var fc geojson.FeatureCollection
+
+		if err := json.NewDecoder(bytes.NewReader(body)).Decode(&fc); err != nil {
+			b.Fatal(err)
+		}
+
+		kept := fc.Features[:0]
+		for _, f := range fc.Features {
+			if benchmarkKeep(f) {
+				kept = append(kept, f)
+			}
+		}
+		fc.Features = kept
+	}
+}
+
+func TestSearchTargetsNoPatterns(t *testing.T) {
+	// as from search-url-pattern: [] in the config file
+	setConfig(t, map[string]interface{}{"search-url-pattern": []interface{}{}})
+
+	if _, err := searchTargets(); !errors.Is(err, errMissingSearchURLPattern) {
+		t.Errorf("got %v, want %v", err, errMissingSearchURLPattern)
+	}
+
+	// a source with its own pattern doesn't need any
+	viper.Set("search-source", []string{"sites=https://pharmacy.example/%s.json"})
+
+	if _, err := searchTargets(); err != nil {
+		t.Errorf("got %v, want no error", err)
+	}
+}
+
+func TestSearchURLEncodesParams(t *testing.T) {
+	tests := []struct {
+		name   string
+		encode bool
+		want   string
+	}{
+		{"raw", false, "https://example.com/search/New York/a&b=c?zip=07030"},
+		{"encoded", true, "https://example.com/search/New%20York/a%26b%3Dc?zip=07030"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setConfig(t, map[string]interface{}{"url-encode-params": tt.encode})
+
+			got := searchURL("https://example.com/search/%s/%s?zip=07030", []string{"New York", "a&b=c"})
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchNotModifiedKeepsAgain(t *testing.T) {
+	const etag = `"v1"`
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		fmt.Fprint(w, `{"type":"FeatureCollection","features":[`+
+			`{"type":"Feature","geometry":{"type":"Point","coordinates":[-74.0,40.7]},"properties":{"id":1}},`+
+			`{"type":"Feature","geometry":{"type":"Point","coordinates":[-74.0,40.7]},"properties":{"id":2}}]}`)
+	}))
+	defer srv.Close()
+
+	setConfig(t, map[string]interface{}{
+		"search-url-pattern": []string{srv.URL + "/%s.json"},
+		"states":             []string{"NJ"},
+		"search-retries":     0,
+	})
+	source := newSearchSource(zerolog.Nop())
+
+	keepID := func(id float64) func(*geojson.Feature) bool {
+		return func(f *geojson.Feature) bool { return f.Properties.MustFloat64("id", 0) == id }
+	}
+
+	for _, id := range []float64{1, 2} {
+		fc, total, err := source.Fetch(context.Background(), keepID(id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != 2 || len(fc.Features) != 1 || fc.Features[0].Properties.MustFloat64("id", 0) != id {
+			t.Errorf("got %d of %d total, want only site %v of 2", len(fc.Features), total, id)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const serverShutdownTimeout = 5 * time.Second
+
+// startServer serves handler on addr until ctx is done. The returned channel is closed
+// once the server has shut down.
+func startServer(ctx context.Context, name, addr string, handler http.Handler, log zerolog.Logger) <-chan struct{} {
+	srv := &http.Server{Addr: addr, Handler: handler}
+	done := make(chan struct{})
+
+	go func() {
+		log.Info().Str("addr", addr).Msgf("starting %s server", name)
+
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error().Err(err).Msgf("%s server failed", name)
+		}
+	}()
+
+	go func() {
+		defer close(done)
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+		defer cancel()
+
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Error().Err(err).Msgf("error shutting down %s server", name)
+		}
+	}()
+
+	return done
+}
+
+// pprofHandler serves the pprof endpoints under /debug/pprof/, like importing
+// net/http/pprof does for the default mux.
+func pprofHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	return mux
+}
+
+// triggerHandler runs a check with ctx on each POST, outside the usual schedule, and
+// responds with the result as JSON.
+func triggerHandler(ctx context.Context, checker *Checker, log zerolog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "use POST to trigger a check", http.StatusMethodNotAllowed)
+			return
+		}
+		log.Info().Str("remote_addr", r.RemoteAddr).Msg("check triggered")
+
+		result, err := checker.Check(ctx)
+		if err != nil {
+			log.Error().Err(err).Msg("error in triggered check")
+
+			if result == nil {
+				http.Error(w, err.Error(), http.StatusBadGateway)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", contentTypeJSON)
+		if err != nil {
+			// still say what the rest of it found
+			w.WriteHeader(http.StatusBadGateway)
+		}
+		// it reads the settings, which a reload could be changing
+		checker.withSettings(func() {
+			if err := writeCheckOutput(w, result, result.NewFeatures, checker.Locations, checker.typeMap); err != nil {
+				log.Error().Err(err).Msg("error writing triggered check result")
+			}
+		})
+	})
+}
+
+// healthHandler reports healthy if checker has had a successful check within staleness.
+func healthHandler(checker *Checker, staleness time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		last := checker.LastSuccess()
+
+		if last.IsZero() || time.Since(last) > staleness {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintf(w, "no successful check since %s\n", formatLastSuccess(last))
+			return
+		}
+		fmt.Fprintf(w, "ok, last successful check %s\n", formatLastSuccess(last))
+	})
+}
+
+func formatLastSuccess(t time.Time) string {
+	if t.IsZero() {
+		return "startup"
+	}
+	return t.Format(time.RFC3339)
+}
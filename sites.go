@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/spf13/viper"
+)
+
+// site is an entry in the "sites" response shape, a plain array for providers that
+// publish their own availability rather than going through vaccinespotter:
+//
+//	[{"name": "Hoboken Pharmacy", "address": "1 Main", "city": "Hoboken", "state": "NJ",
+//	  "postal_code": "07030", "latitude": 40.74, "longitude": -74.03, "available": true,
+//	  "appointments": [{"time": "2021-04-09T14:30:00-04:00", "type": "Pfizer"}]}]
+type site struct {
+	Name         string            `json:"name"`
+	Address      string            `json:"address"`
+	City         string            `json:"city"`
+	State        string            `json:"state"`
+	PostalCode   string            `json:"postal_code"`
+	Latitude     float64           `json:"latitude"`
+	Longitude    float64           `json:"longitude"`
+	Available    bool              `json:"available"`
+	Appointments []siteAppointment `json:"appointments"`
+}
+
+type siteAppointment struct {
+	Time string `json:"time"`
+	Type string `json:"type"`
+}
+
+// feature maps s onto the properties the filters and output use. Sites have no
+// vaccinespotter id, so they're told apart by name and address instead.
+func (s *site) feature() *geojson.Feature {
+	f := geojson.NewFeature(orb.Point{s.Longitude, s.Latitude})
+
+	f.Properties["provider_brand_name"] = s.Name
+	f.Properties["address"] = s.Address
+	f.Properties["city"] = s.City
+	f.Properties["state"] = s.State
+	f.Properties["postal_code"] = s.PostalCode
+	f.Properties[viper.GetString("appointments-available-field")] = s.Available
+
+	appts := []interface{}{}
+
+	for _, a := range s.Appointments {
+		appts = append(appts, map[string]interface{}{"time": a.Time, "type": a.Type})
+	}
+	f.Properties[viper.GetString("appointments-field")] = appts
+
+	return f
+}
+
+// decodeSites decodes the "sites" shape one site at a time, like decodeFeatures. It's a
+// bare array, so there's nowhere for a next page link; use --page-param instead.
+func decodeSites(r io.Reader, keep func(*geojson.Feature) bool) (*geojson.FeatureCollection, int, string, error) {
+	var (
+		dec   = json.NewDecoder(r)
+		fc    = geojson.NewFeatureCollection()
+		total int
+	)
+
+	if err := expectDelim(dec, '['); err != nil {
+		return nil, 0, "", err
+	}
+	for dec.More() {
+		var s site
+
+		if err := dec.Decode(&s); err != nil {
+			return nil, 0, "", fmt.Errorf("site %d: %w", total, err)
+		}
+		total++
+
+		if f := s.feature(); keep(f) {
+			fc.Features = append(fc.Features, f)
+		}
+	}
+	if err := expectDelim(dec, ']'); err != nil {
+		return nil, 0, "", err
+	}
+	return fc, total, "", nil
+}
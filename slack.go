@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/spf13/viper"
+)
+
+// slackNotifier posts found sites to a Slack incoming webhook.
+type slackNotifier struct {
+	client     *http.Client
+	webhookURL string
+	locations  orb.MultiPoint
+	unit       string
+}
+
+func newSlackNotifier(client *http.Client, locations orb.MultiPoint, unit string) *slackNotifier {
+	return &slackNotifier{
+		client:     client,
+		webhookURL: viper.GetString("slack-webhook-url"),
+		locations:  locations,
+		unit:       unit,
+	}
+}
+
+func (n *slackNotifier) Notify(ctx context.Context, found []*geojson.Feature) error {
+	text, err := notificationText(ctx, found, n.locations)
+	if err != nil {
+		return err
+	}
+
+	msg := struct {
+		Text string `json:"text"`
+	}{
+		Text: fmt.Sprintf("%s:\n```\n%s```", notificationTitle(ctx, len(found)), text),
+	}
+
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("error encoding slack message: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.webhookURL, bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentTypeJSON)
+	req.Header.Set("User-Agent", userAgent)
+
+	_, err = sendNotification(ctx, n.client, req)
+	return err
+}
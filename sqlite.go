@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/spf13/viper"
+)
+
+const resultSchema = `
+CREATE TABLE IF NOT EXISTS checks (
+	id        INTEGER PRIMARY KEY AUTOINCREMENT,
+	timestamp TIMESTAMP NOT NULL,
+	available INTEGER NOT NULL,
+	nearby    INTEGER NOT NULL,
+	new       INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS found (
+	check_id          INTEGER NOT NULL REFERENCES checks(id),
+	site_id           INTEGER NOT NULL,
+	provider          TEXT NOT NULL,
+	address           TEXT NOT NULL,
+	city              TEXT NOT NULL,
+	state             TEXT NOT NULL,
+	distance_km       REAL NOT NULL,
+	appointment_count INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS found_site_id ON found(site_id);
+`
+
+// resultStore records every check, and the nearby sites it found, in a SQLite database.
+type resultStore struct {
+	db *sql.DB
+}
+
+func openResultStore(path string) (*resultStore, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening results database: %w", err)
+	}
+
+	if _, err := db.Exec(resultSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating results schema in %s: %w", path, err)
+	}
+	return &resultStore{db: db}, nil
+}
+
+func (s *resultStore) record(ctx context.Context, at time.Time, result *CheckResult, found []*geojson.Feature, locations orb.MultiPoint, mappings []typeMapping) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error recording results: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		"INSERT INTO checks (timestamp, available, nearby, new) VALUES (?, ?, ?, ?)",
+		at.UTC(), result.Available, result.Nearby, result.New,
+	)
+	if err != nil {
+		return fmt.Errorf("error recording check: %w", err)
+	}
+	checkID, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("error recording check: %w", err)
+	}
+
+	for _, f := range found {
+		out := newOutputFeature(f, locations, mappings)
+
+		if _, err := tx.Exec(
+			"INSERT INTO found (check_id, site_id, provider, address, city, state, distance_km, appointment_count) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+			checkID, out.ID, out.Provider, out.Address, out.City, out.State, out.DistanceKM, appointmentCount(f, viper.GetInt("unlisted-appointments")),
+		); err != nil {
+			return fmt.Errorf("error recording found site: %w", err)
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// stateStore persists the featureKey of each site we've already notified about, so a
+// restart doesn't re-notify about the same sites.
+type stateStore struct {
+	path string
+	ttl  time.Duration
+
+	Notified map[string]time.Time `json:"notified"`
+}
+
+func loadState(path string, ttl time.Duration) (*stateStore, error) {
+	s := &stateStore{
+		path:     path,
+		ttl:      ttl,
+		Notified: map[string]time.Time{},
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("error reading state file: %w", err)
+	}
+
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, fmt.Errorf("error parsing state file %s: %w", path, err)
+	}
+	if s.Notified == nil {
+		s.Notified = map[string]time.Time{}
+	}
+	// older state files have just the ids
+	for key, at := range s.Notified {
+		if id, err := strconv.Atoi(key); err == nil {
+			delete(s.Notified, key)
+			s.Notified[fmt.Sprintf("id:%d", id)] = at
+		}
+	}
+	s.prune(time.Now())
+
+	return s, nil
+}
+
+func (s *stateStore) record(keys []string, at time.Time) {
+	for _, key := range keys {
+		s.Notified[key] = at
+	}
+	s.prune(at)
+}
+
+// prune drops entries older than the TTL. A zero TTL keeps everything.
+func (s *stateStore) prune(now time.Time) {
+	if s.ttl <= 0 {
+		return
+	}
+	for key, at := range s.Notified {
+		if now.Sub(at) > s.ttl {
+			delete(s.Notified, key)
+		}
+	}
+}
+
+func (s *stateStore) save() error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding state: %w", err)
+	}
+
+	// write to a temp file and rename, so a crash mid-write can't corrupt the state
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return fmt.Errorf("error creating state file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing state file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing state file: %w", err)
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
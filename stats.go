@@ -0,0 +1,50 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/paulmach/orb/geojson"
+)
+
+// runStats counts what a Checker has done since it started, for the recap at shutdown.
+type runStats struct {
+	mu            sync.Mutex
+	started       time.Time
+	checks        int
+	sites         map[string]struct{} // featureKey of every nearby site found
+	notifications int
+}
+
+func newRunStats() *runStats {
+	return &runStats{started: time.Now(), sites: map[string]struct{}{}}
+}
+
+func (s *runStats) checked(found []*geojson.Feature) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.checks++
+
+	for _, f := range found {
+		if key := featureKey(f); key != "" {
+			s.sites[key] = struct{}{}
+		}
+	}
+}
+
+func (s *runStats) notified() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.notifications++
+}
+
+// Stats is what's been done so far: checks that got as far as handling their results,
+// distinct nearby sites found, notifications sent and how long it's been running.
+func (c *Checker) Stats() (checks, sites, notifications int, uptime time.Duration) {
+	c.stats.mu.Lock()
+	defer c.stats.mu.Unlock()
+
+	return c.stats.checks, len(c.stats.sites), c.stats.notifications, time.Since(c.stats.started)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/spf13/viper"
+)
+
+const telegramAPIURL = "https://api.telegram.org"
+
+var (
+	errTelegramFailed = errors.New("telegram request failed")
+
+	// characters that need escaping in Telegram's legacy Markdown
+	telegramEscaper = strings.NewReplacer("_", `\_`, "*", `\*`, "`", "\\`", "[", `\[`)
+)
+
+// telegramNotifier sends found sites as a message from a Telegram bot.
+type telegramNotifier struct {
+	client    *http.Client
+	botToken  string
+	chatID    string
+	locations orb.MultiPoint
+	unit      string
+}
+
+func newTelegramNotifier(client *http.Client, locations orb.MultiPoint, unit string) *telegramNotifier {
+	return &telegramNotifier{
+		client:    client,
+		botToken:  viper.GetString("telegram-bot-token"),
+		chatID:    viper.GetString("telegram-chat-id"),
+		locations: locations,
+		unit:      unit,
+	}
+}
+
+func (n *telegramNotifier) Notify(ctx context.Context, found []*geojson.Feature) error {
+	text, err := n.text(ctx, found)
+	if err != nil {
+		return err
+	}
+
+	msg := struct {
+		ChatID    string `json:"chat_id"`
+		Text      string `json:"text"`
+		ParseMode string `json:"parse_mode"`
+	}{
+		ChatID:    n.chatID,
+		Text:      fmt.Sprintf("*%s*\n%s", notificationTitle(ctx, len(found)), text),
+		ParseMode: "Markdown",
+	}
+
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("error encoding telegram message: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/bot%s/sendMessage", telegramAPIURL, n.botToken), bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentTypeJSON)
+	req.Header.Set("User-Agent", userAgent)
+
+	b, err = sendNotification(ctx, n.client, req)
+	if err != nil || b == nil {
+		return err
+	}
+
+	var resp struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+
+	if err := json.Unmarshal(b, &resp); err != nil {
+		return fmt.Errorf("error parsing telegram response: %w", err)
+	}
+	if !resp.OK {
+		return fmt.Errorf("%w: %s", errTelegramFailed, resp.Description)
+	}
+	return nil
+}
+
+// text is the escaped body of the message: --notification-template if it's set, or else a
+// bullet for each site.
+func (n *telegramNotifier) text(ctx context.Context, found []*geojson.Feature) (string, error) {
+	if viper.GetString("notification-template") != "" {
+		text, err := notificationText(ctx, found, n.locations)
+		return telegramEscaper.Replace(text), err
+	}
+
+	var sb strings.Builder
+
+	for _, f := range found {
+		fmt.Fprintf(&sb, "• %s\n", telegramEscaper.Replace(featureSummary(f, n.locations, n.unit)))
+	}
+	return sb.String(), nil
+}
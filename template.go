@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"text/template"
+	"time"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/spf13/viper"
+)
+
+// defaultNotificationTemplate lays out sites the same way they're printed to the console.
+const defaultNotificationTemplate = `{{range $i, $f := .Features}}{{if $i}}
+{{end}}{{$f.Provider}} - {{$f.Address}}, {{$f.City}}, {{$f.State}} - {{printf "%.2f" (distance $f.DistanceKM)}} {{$.Unit}}
+{{range $f.Appointments}}  {{displayTime .Time}}: {{or .Canonical .Type}}
+{{end}}{{end}}`
+
+// defaultLineTemplate is how each site is printed to the console.
+const defaultLineTemplate = `{{.Provider}} - {{.Address}}, {{.City}}, {{.State}} - {{printf "%.2f" .Distance}} {{.Unit}}
+{{range .Appointments}}  {{.Time}}: {{or .Canonical .Type}}
+{{end}}`
+
+// lineData is what --line-template is rendered against, for each site printed.
+type lineData struct {
+	Provider     string
+	Address      string
+	City         string
+	State        string
+	Distance     float64 // from the nearest location, in Unit
+	Unit         string
+	Appointments []outputAppointment // with Time as it's displayed, and the Type normalized too
+}
+
+func newLineData(f *geojson.Feature, locations orb.MultiPoint, unit string, mappings []typeMapping) lineData {
+	ret := lineData{
+		Provider:     f.Properties.MustString("provider_brand_name", "(unknown name)"),
+		Address:      f.Properties.MustString("address", "(unknown address)"),
+		City:         f.Properties.MustString("city", "(unknown city)"),
+		State:        f.Properties.MustString("state", "(unknown state)"),
+		Distance:     nearestDistance(f.Geometry.(orb.Point), locations) / distanceUnits[unit],
+		Unit:         unit,
+		Appointments: []outputAppointment{},
+	}
+
+	for _, fields := range sortedAppointments(f, viper.GetString("time-layout")) {
+		ret.Appointments = append(ret.Appointments, newOutputAppointment(
+			fmt.Sprint(displayTime(fields)),
+			fmt.Sprint(mapString(fields, "type", "(unknown type)")),
+			mappings,
+		))
+	}
+	return ret
+}
+
+// lineTemplate parses --line-template, or the default console format if it isn't set,
+// checking it against sample data like parseTemplate.
+func lineTemplate() (*template.Template, error) {
+	text := viper.GetString("line-template")
+	if text == "" {
+		text = defaultLineTemplate
+	}
+
+	t, err := template.New("line-template").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := t.Execute(ioutil.Discard, lineData{Appointments: []outputAppointment{{}}}); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// notificationData is what notification templates are rendered against.
+type notificationData struct {
+	Event          string
+	Title          string
+	Timestamp      time.Time
+	Latitude       float64 // of the first location, if there are several
+	Longitude      float64
+	Unit           string
+	AvailableCount int
+	NearbyCount    int
+	NewCount       int
+	Features       []outputFeature
+}
+
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	// distance converts km to --distance-unit
+	"distance": func(km float64) float64 {
+		return km * metersPerKilometer / distanceUnits[viper.GetString("distance-unit")]
+	},
+	// displayTime formats an appointment time the way the console does
+	"displayTime": func(at string) interface{} {
+		return displayTime(map[string]interface{}{"time": at})
+	},
+}
+
+type resultKey struct{}
+
+// withResult attaches the result of the check being notified about to ctx.
+func withResult(ctx context.Context, result *CheckResult) context.Context {
+	return context.WithValue(ctx, resultKey{}, result)
+}
+
+func resultFrom(ctx context.Context) *CheckResult {
+	if result, ok := ctx.Value(resultKey{}).(*CheckResult); ok {
+		return result
+	}
+	return &CheckResult{}
+}
+
+func newNotificationData(ctx context.Context, found []*geojson.Feature, locations orb.MultiPoint) notificationData {
+	var (
+		result   = resultFrom(ctx)
+		mappings = typeMapFrom(ctx)
+	)
+
+	ret := notificationData{
+		Event:          eventFrom(ctx),
+		Title:          notificationTitle(ctx, len(found)),
+		Timestamp:      time.Now(),
+		Latitude:       locations[0].Lat(),
+		Longitude:      locations[0].Lon(),
+		Unit:           viper.GetString("distance-unit"),
+		AvailableCount: result.Available,
+		NearbyCount:    result.Nearby,
+		NewCount:       len(found),
+		Features:       []outputFeature{},
+	}
+
+	for _, f := range found {
+		ret.Features = append(ret.Features, newOutputFeature(f, locations, mappings))
+	}
+	return ret
+}
+
+// parseTemplate parses text and renders it against sample data, so that mistakes like
+// misspelled fields show up at startup rather than at the first notification.
+func parseTemplate(name, text string) (*template.Template, error) {
+	t, err := template.New(name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	sample := notificationData{
+		Timestamp: time.Now(),
+		Features:  []outputFeature{{Appointments: []outputAppointment{{}}}},
+	}
+	if err := t.Execute(ioutil.Discard, sample); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// notificationTemplate is --notification-template, or the console format if it isn't set.
+func notificationTemplate() string {
+	if text := viper.GetString("notification-template"); text != "" {
+		return text
+	}
+	return defaultNotificationTemplate
+}
+
+// notificationText renders the notification template about found, for the notifiers that
+// send a message rather than data.
+func notificationText(ctx context.Context, found []*geojson.Feature, locations orb.MultiPoint) (string, error) {
+	b, err := renderTemplate("notification-template", notificationTemplate(), newNotificationData(ctx, found, locations))
+	return string(b), err
+}
+
+func renderTemplate(name, text string, data notificationData) ([]byte, error) {
+	t, err := parseTemplate(name, text)
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+
+	if err := t.Execute(&b, data); err != nil {
+		return nil, fmt.Errorf("error rendering %s: %w", name, err)
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/spf13/viper"
+)
+
+var (
+	errInvalidProxy  = errors.New("invalid --proxy, should be an http, https or socks5 URL")
+	errInvalidCACert = errors.New("no certificates found")
+)
+
+// newTransport returns a transport going through --proxy, or whatever proxy the
+// environment sets if it isn't given. If prefix is set, the --<prefix>-insecure-skip-verify
+// and --<prefix>-ca-cert TLS options apply too.
+func newTransport(prefix string) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+
+	if u, err := parseProxy(viper.GetString("proxy")); err == nil && u != nil {
+		t.Proxy = http.ProxyURL(u)
+	}
+	if prefix != "" {
+		if cfg, err := tlsConfig(prefix); err == nil && cfg != nil {
+			t.TLSClientConfig = cfg
+		}
+	}
+	return t
+}
+
+// tlsConfig builds the TLS config for the --<prefix>-* options, or returns nil if none
+// are set.
+func tlsConfig(prefix string) (*tls.Config, error) {
+	var (
+		skipVerify = viper.GetBool(prefix + "-insecure-skip-verify")
+		caCert     = viper.GetString(prefix + "-ca-cert")
+	)
+
+	if !skipVerify && caCert == "" {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{InsecureSkipVerify: skipVerify}
+
+	if caCert != "" {
+		b, err := ioutil.ReadFile(caCert)
+		if err != nil {
+			return nil, fmt.Errorf("error reading --%s-ca-cert: %w", prefix, err)
+		}
+
+		// trust it as well as the usual roots
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("invalid --%s-ca-cert %s: %w", prefix, caCert, errInvalidCACert)
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
+
+// parseProxy parses a proxy URL, or returns nil if there isn't one.
+func parseProxy(s string) (*url.URL, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidProxy, err)
+	}
+
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("%w: %s", errInvalidProxy, s)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("%w: %s", errInvalidProxy, s)
+	}
+	return u, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"math"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+// distanceTrend is a ring buffer of the nearest nearby site's distance at each of the
+// last few checks, in meters. Checks with nothing nearby are recorded as NaN.
+type distanceTrend struct {
+	nearest []float64
+	next    int
+	full    bool
+}
+
+func newDistanceTrend(size int) *distanceTrend {
+	return &distanceTrend{nearest: make([]float64, size)}
+}
+
+func (t *distanceTrend) add(d float64) {
+	if len(t.nearest) == 0 {
+		return
+	}
+	t.nearest[t.next] = d
+	t.next = (t.next + 1) % len(t.nearest)
+
+	if t.next == 0 {
+		t.full = true
+	}
+}
+
+// oldest is the earliest distance still in the buffer that had something nearby, and how
+// many checks ago that was.
+func (t *distanceTrend) oldest() (float64, int, bool) {
+	n := t.next
+	if t.full {
+		n = len(t.nearest)
+	}
+
+	for ago := n; ago > 0; ago-- {
+		i := (t.next - ago + len(t.nearest)) % len(t.nearest)
+
+		if d := t.nearest[i]; !math.IsNaN(d) {
+			return d, ago, true
+		}
+	}
+	return 0, 0, false
+}
+
+// trendCheck records the nearest of found, which is sorted by distance, and logs how it
+// compares with the oldest check still in the trend.
+func (c *Checker) trendCheck(found []*geojson.Feature) {
+	nearest := math.NaN()
+	if len(found) > 0 {
+		nearest = nearestDistance(found[0].Geometry.(orb.Point), c.Locations)
+	}
+	nearestSite.Set(nearest)
+
+	if c.trend == nil {
+		return
+	}
+	before, ago, ok := c.trend.oldest()
+	c.trend.add(nearest)
+
+	if math.IsNaN(nearest) || !ok {
+		return
+	}
+
+	scale := distanceUnits[c.Unit]
+	change := "unchanged"
+
+	switch {
+	case nearest < before:
+		change = "down"
+	case nearest > before:
+		change = "up"
+	}
+	c.log.Info().
+		Float64("nearest", nearest/scale).
+		Float64("previous", before/scale).
+		Int("checks_ago", ago).
+		Msgf("nearest site %.1f %s, %s from %.1f %s %d checks ago", nearest/scale, c.Unit, change, before/scale, c.Unit, ago)
+}
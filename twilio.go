@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/spf13/viper"
+)
+
+const (
+	twilioAPIURL = "https://api.twilio.com/2010-04-01"
+
+	// the most that fits in a single SMS segment, depending on whether it can be sent as
+	// GSM-7 or has to be UCS-2, which we take to be anything that isn't ASCII
+	smsSegmentLength        = 160
+	smsUnicodeSegmentLength = 70
+)
+
+var (
+	errTwilioFailed = errors.New("twilio request failed")
+)
+
+// twilioNotifier texts a short summary of found sites with Twilio.
+type twilioNotifier struct {
+	client     *http.Client
+	accountSID string
+	authToken  string
+	from       string
+	to         []string
+	locations  orb.MultiPoint
+	unit       string
+
+	// the sites each recipient has been texted about, by featureKey, until every recipient
+	// has, so retrying after some of them failed doesn't text the rest again
+	mu   sync.Mutex
+	sent map[string]map[string]bool
+}
+
+func newTwilioNotifier(client *http.Client, locations orb.MultiPoint, unit string) *twilioNotifier {
+	return &twilioNotifier{
+		client:     client,
+		accountSID: viper.GetString("twilio-account-sid"),
+		authToken:  viper.GetString("twilio-auth-token"),
+		from:       viper.GetString("twilio-from"),
+		to:         viper.GetStringSlice("twilio-to"),
+		locations:  locations,
+		unit:       unit,
+		sent:       map[string]map[string]bool{},
+	}
+}
+
+// Notify texts each recipient about the sites in found they haven't had yet, carrying on
+// past any that fail.
+func (n *twilioNotifier) Notify(ctx context.Context, found []*geojson.Feature) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var (
+		errs *multierror.Error
+		// cleared sites are only news this once
+		track = eventFrom(ctx) == eventFound
+	)
+
+	for _, to := range n.to {
+		pending := found
+		if track {
+			pending = n.unsent(to, found)
+		}
+		if len(pending) == 0 {
+			continue
+		}
+
+		if err := n.send(ctx, to, n.message(ctx, pending)); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("%w: %s: %v", errTwilioFailed, to, err))
+			continue
+		}
+		if track {
+			n.markSent(to, pending)
+		}
+	}
+	if errs != nil {
+		return errs
+	}
+
+	// everyone has them now, so the checker won't be sending them again
+	for _, sent := range n.sent {
+		for _, f := range found {
+			delete(sent, featureKey(f))
+		}
+	}
+	return nil
+}
+
+// unsent is the sites in found that to hasn't been texted about.
+func (n *twilioNotifier) unsent(to string, found []*geojson.Feature) []*geojson.Feature {
+	var ret []*geojson.Feature
+
+	for _, f := range found {
+		if key := featureKey(f); key == "" || !n.sent[to][key] {
+			ret = append(ret, f)
+		}
+	}
+	return ret
+}
+
+func (n *twilioNotifier) markSent(to string, sent []*geojson.Feature) {
+	if n.sent[to] == nil {
+		n.sent[to] = map[string]bool{}
+	}
+	for _, f := range sent {
+		if key := featureKey(f); key != "" {
+			n.sent[to][key] = true
+		}
+	}
+}
+
+// message sums up found in a single SMS segment: how many there are, and the nearest one.
+func (n *twilioNotifier) message(ctx context.Context, found []*geojson.Feature) string {
+	msg := notificationTitle(ctx, len(found))
+
+	if len(found) > 0 {
+		// found isn't always sorted by distance, as a batch joins the sites of several checks
+		f, d := found[0], math.Inf(1)
+
+		for _, ff := range found {
+			if fd := nearestDistance(ff.Geometry.(orb.Point), n.locations); fd < d {
+				f, d = ff, fd
+			}
+		}
+
+		msg += fmt.Sprintf(
+			". Nearest: %s, %s, %.1f %s",
+			f.Properties.MustString("provider_brand_name", "(unknown name)"),
+			f.Properties.MustString("city", "(unknown city)"),
+			d/distanceUnits[n.unit],
+			n.unit,
+		)
+	}
+	return truncateSMS(msg)
+}
+
+func (n *twilioNotifier) send(ctx context.Context, to, body string) error {
+	form := url.Values{
+		"From": {n.from},
+		"To":   {to},
+		"Body": {body},
+	}
+
+	req, err := newRequestWithBody(
+		ctx,
+		http.MethodPost,
+		fmt.Sprintf("%s/Accounts/%s/Messages.json", twilioAPIURL, url.PathEscape(n.accountSID)),
+		strings.NewReader(form.Encode()),
+		contentTypeForm,
+		nil,
+	)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.SetBasicAuth(n.accountSID, n.authToken)
+
+	b, err := sendNotification(ctx, n.client, req)
+	if err != nil || b == nil {
+		return err
+	}
+
+	var resp struct {
+		Status       string `json:"status"`
+		ErrorCode    *int   `json:"error_code"`
+		ErrorMessage string `json:"error_message"`
+	}
+
+	if err := json.Unmarshal(b, &resp); err != nil {
+		return fmt.Errorf("error parsing twilio response: %w", err)
+	}
+	if resp.ErrorCode != nil {
+		return fmt.Errorf("error %d: %s", *resp.ErrorCode, resp.ErrorMessage)
+	}
+	return nil
+}
+
+// truncateSMS cuts msg down to a single segment.
+func truncateSMS(msg string) string {
+	max := smsSegmentLength
+
+	for _, r := range msg {
+		if r >= utf8.RuneSelf {
+			max = smsUnicodeSegmentLength
+			break
+		}
+	}
+
+	if utf8.RuneCountInString(msg) <= max {
+		return msg
+	}
+	return string([]rune(msg)[:max-3]) + "..."
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+func TestTwilioMessageNearest(t *testing.T) {
+	setConfig(t, nil)
+
+	site := func(city string, p orb.Point) *geojson.Feature {
+		f := geojson.NewFeature(p)
+		f.Properties["provider_brand_name"] = "CVS"
+		f.Properties["city"] = city
+		return f
+	}
+	n := newTwilioNotifier(http.DefaultClient, orb.MultiPoint{{-74.03, 40.74}}, "km")
+
+	// as a batch of two checks would give them, each sorted but not the two together
+	msg := n.message(context.Background(), []*geojson.Feature{
+		site("Newark", orb.Point{-74.17, 40.73}),
+		site("Hoboken", orb.Point{-74.03, 40.745}),
+		site("Jersey City", orb.Point{-74.07, 40.72}),
+	})
+
+	if !strings.Contains(msg, "Nearest: CVS, Hoboken") {
+		t.Errorf("got %q, want Hoboken as the nearest", msg)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/paulmach/orb/geojson"
+	"github.com/spf13/viper"
+)
+
+const dateLayout = "2006-01-02"
+
+var (
+	errInvalidDate = errors.New("invalid date, should be YYYY-MM-DD")
+)
+
+// appointmentWindow limits which appointment times count. Dates and times of day are
+// compared in the appointment's own timezone, and all ends are inclusive.
+type appointmentWindow struct {
+	earliestDate string
+	latestDate   string
+
+	// minutes since midnight, or -1 if unset
+	earliestTime int
+	latestTime   int
+}
+
+func parseAppointmentWindow(earliestDate, latestDate, earliestTime, latestTime string) (appointmentWindow, error) {
+	for _, d := range []string{earliestDate, latestDate} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.Parse(dateLayout, d); err != nil {
+			return appointmentWindow{}, fmt.Errorf("%w: %q", errInvalidDate, d)
+		}
+	}
+
+	ret := appointmentWindow{
+		earliestDate: earliestDate,
+		latestDate:   latestDate,
+		earliestTime: -1,
+		latestTime:   -1,
+	}
+	var err error
+
+	if earliestTime != "" {
+		if ret.earliestTime, err = parseClock(earliestTime); err != nil {
+			return appointmentWindow{}, err
+		}
+	}
+	if latestTime != "" {
+		if ret.latestTime, err = parseClock(latestTime); err != nil {
+			return appointmentWindow{}, err
+		}
+	}
+	return ret, nil
+}
+
+func appointmentWindowFromConfig() (appointmentWindow, error) {
+	return parseAppointmentWindow(
+		viper.GetString("earliest-date"),
+		viper.GetString("latest-date"),
+		viper.GetString("earliest-time"),
+		viper.GetString("latest-time"),
+	)
+}
+
+func (w appointmentWindow) active() bool {
+	return w.earliestDate != "" || w.latestDate != "" || w.earliestTime >= 0 || w.latestTime >= 0
+}
+
+func (w appointmentWindow) contains(t time.Time) bool {
+	// YYYY-MM-DD sorts lexically
+	d := t.Format(dateLayout)
+
+	if w.earliestDate != "" && d < w.earliestDate {
+		return false
+	}
+	if w.latestDate != "" && d > w.latestDate {
+		return false
+	}
+
+	m := t.Hour()*60 + t.Minute()
+
+	if w.earliestTime >= 0 && m < w.earliestTime {
+		return false
+	}
+	if w.latestTime >= 0 && m > w.latestTime {
+		return false
+	}
+	return true
+}
+
+// filterAppointments drops f's appointments that aren't within w, so they're neither
+// counted nor shown, returning how many are left. Appointment times that don't parse
+// with layout are dropped too.
+func filterAppointments(f *geojson.Feature, w appointmentWindow, layout string) int {
+	var kept []interface{}
+
+	for _, fields := range featureAppointments(f) {
+		if t, ok := appointmentTime(fields, layout); ok && w.contains(t) {
+			kept = append(kept, fields)
+		}
+	}
+	f.Properties[viper.GetString("appointments-field")] = kept
+
+	return len(kept)
+}
+
+// dropPast drops f's appointments from before cutoff, keeping any whose time doesn't parse
+// with layout, and reports whether f is still worth including: it either listed no
+// appointments to begin with, or still has at least --min-appointments.
+func dropPast(f *geojson.Feature, cutoff time.Time, layout string) bool {
+	appts := featureAppointments(f)
+	if len(appts) == 0 {
+		return true
+	}
+
+	var kept []interface{}
+
+	for _, fields := range appts {
+		if t, ok := appointmentTime(fields, layout); !ok || !t.Before(cutoff) {
+			kept = append(kept, fields)
+		}
+	}
+	if len(kept) < len(appts) {
+		f.Properties[viper.GetString("appointments-field")] = kept
+	}
+	return len(kept) > 0 && len(kept) >= viper.GetInt("min-appointments")
+}
+
+func appointmentTime(fields map[string]interface{}, layout string) (time.Time, bool) {
+	s, ok := mapString(fields, "time", nil).(string)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	t, err := time.Parse(layout, s)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}